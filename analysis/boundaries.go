@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"fmt"
+	"hanamilsp/lsp"
+	"slices"
+)
+
+// BoundaryViolation reports why the slice named from may not inject c, a
+// component of another slice: either that slice does not export it, or from
+// does not import it. Injections within a slice, or from or into the app and
+// lib containers, never violate a boundary.
+func (idx *Index) BoundaryViolation(from string, c Component) (string, bool) {
+	importer, ok := idx.Slices[from]
+	if !ok || c.Container == from {
+		return "", false
+	}
+
+	exporter, ok := idx.Slices[c.Container]
+	if !ok {
+		return "", false
+	}
+
+	if exporter.Exports != nil && !slices.Contains(exporter.Exports, c.Key) {
+		return fmt.Sprintf("'%s' is not exported by slice '%s'", c.Key, c.Container), true
+	}
+
+	for _, imp := range importer.Imports {
+		if imp.From == c.Container && (imp.Keys == nil || slices.Contains(imp.Keys, c.Key)) {
+			return "", false
+		}
+	}
+
+	return fmt.Sprintf("slice '%s' does not import '%s' from slice '%s'", from, c.Key, c.Container), true
+}
+
+// boundaryDiagnostic flags entry, a Deps entry in the file at uri, when it
+// injects a component across a slice boundary that was not declared.
+func (s *State) boundaryDiagnostic(uri string, entry DepsEntry) (lsp.Diagnostic, bool) {
+	if s.Index == nil {
+		return lsp.Diagnostic{}, false
+	}
+
+	from, ok := s.Index.ContainerForURI(uri)
+	if !ok {
+		return lsp.Diagnostic{}, false
+	}
+
+	c, ok := s.Index.Resolve(entry.Key, from)
+	if !ok {
+		return lsp.Diagnostic{}, false
+	}
+
+	message, ok := s.Index.BoundaryViolation(from, c)
+	if !ok {
+		return lsp.Diagnostic{}, false
+	}
+
+	severity := s.Config.Boundaries.severity(from, c.Container)
+	if severity == 0 {
+		return lsp.Diagnostic{}, false
+	}
+
+	return lsp.Diagnostic{
+		Range:    entry.Range,
+		Severity: severity,
+		Code:     DiagnosticSliceBoundary,
+		Source:   "hanamilsp",
+		Message:  message,
+	}, true
+}
@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const testBoundariesOperation = `module Billing
+  module Operations
+    class Charge
+      include Deps[
+        "domain.operations.transaction",
+        "domain.repositories.goal_repo",
+        "search.queries.find",
+        "operations.refund"
+      ]
+    end
+  end
+end
+`
+
+func TestBoundaryDiagnostics(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/app.rb":                           "module GoalsService\n  class App < Hanami::App\n    register_slice :billing do\n      import keys: [\"operations.transaction\", \"repositories.goal_repo\"], from: :domain\n    end\n  end\nend\n",
+		"config/slices/domain.rb":                 "module Domain\n  class Slice < Hanami::Slice\n    export [\"operations.transaction\"]\n  end\nend\n",
+		"slices/domain/operations/transaction.rb": "",
+		"slices/domain/repositories/goal_repo.rb": "",
+		"slices/search/queries/find.rb":           "",
+		"slices/billing/operations/charge.rb":     testBoundariesOperation,
+		"slices/billing/operations/refund.rb":     "",
+	})
+	uri := root + "/slices/billing/operations/charge.rb"
+
+	state := NewState(log.New(os.Stdout, "test", 1))
+	state.RootURI = lsp.DocumentURI(root)
+	state.IndexWorkspace()
+
+	t.Run("it flags keys not exported or not imported", func(t *testing.T) {
+		state.OpenDocument(uri, 1, testBoundariesOperation)
+		diagnostics := state.Diagnostics(uri)
+
+		is.Equal(diagnostics, []lsp.Diagnostic{
+			{
+				Range:    LineRange(5, 9, 38),
+				Severity: 1,
+				Code:     DiagnosticSliceBoundary,
+				Source:   "hanamilsp",
+				Message:  "'repositories.goal_repo' is not exported by slice 'domain'",
+			},
+			{
+				Range:    LineRange(6, 9, 28),
+				Severity: 1,
+				Code:     DiagnosticSliceBoundary,
+				Source:   "hanamilsp",
+				Message:  "slice 'billing' does not import 'queries.find' from slice 'search'",
+			},
+		})
+	})
+
+	t.Run("severity is configured per slice pair", func(t *testing.T) {
+		state.SetConfig(Config{Boundaries: BoundaryConfig{
+			Severity: "hint",
+			Slices:   map[string]map[string]string{"billing": {"search": "warning"}, "*": {"domain": "off"}},
+		}})
+
+		diagnostics := state.Diagnostics(uri)
+		is.Equal(len(diagnostics), 1)
+		is.Equal(diagnostics[0].Severity, 2)
+	})
+
+	t.Run("they can be turned off", func(t *testing.T) {
+		state.SetConfig(Config{Diagnostics: map[string]bool{DiagnosticSliceBoundary: false}})
+		is.Equal(len(state.Diagnostics(uri)), 0)
+	})
+}
+
+func TestBoundarySeverity(t *testing.T) {
+	is := is.New(t)
+
+	config := BoundaryConfig{
+		Severity: "warning",
+		Slices: map[string]map[string]string{
+			"admin": {"billing": "off", "*": "information"},
+			"*":     {"billing": "hint", "search": "unknown"},
+		},
+	}
+
+	is.Equal(config.severity("admin", "billing"), 0)
+	is.Equal(config.severity("admin", "search"), 3)
+	is.Equal(config.severity("domain", "billing"), 4)
+	is.Equal(config.severity("domain", "search"), 2)
+	is.Equal(BoundaryConfig{}.severity("domain", "search"), 1)
+}
@@ -0,0 +1,181 @@
+package analysis
+
+import (
+	"context"
+	"hanamilsp/lsp"
+)
+
+// CallHierarchyItem describes component c for the call hierarchy, spanning its
+// class declaration.
+func (s *State) CallHierarchyItem(c Component) lsp.CallHierarchyItem {
+	item := lsp.CallHierarchyItem{
+		Name:   c.QualifiedKey(),
+		Kind:   lsp.SymbolKindClass,
+		Detail: c.ClassName,
+		URI:    c.URI,
+	}
+
+	if document, root, err := s.SyntaxTree(c.URI); err == nil {
+		if class, name := findClassNode(s.Queries, root, document, c.ClassName); class != nil {
+			item.Range = nodeRange(class, document)
+			item.SelectionRange = nodeRange(name, document)
+		}
+	}
+
+	return item
+}
+
+// PrepareCallHierarchy returns the component at position, as resolved by
+// ComponentAt, or else the component whose class encloses position.
+func (s *State) PrepareCallHierarchy(uri string, position lsp.Position) (lsp.CallHierarchyItem, bool) {
+	if c, ok := s.ComponentAt(uri, position); ok {
+		return s.CallHierarchyItem(c), true
+	}
+
+	if s.Index == nil {
+		return lsp.CallHierarchyItem{}, false
+	}
+
+	c, ok := s.Index.ComponentForURI(uri)
+	if !ok {
+		return lsp.CallHierarchyItem{}, false
+	}
+
+	item := s.CallHierarchyItem(c)
+	if !rangeContains(item.Range, lsp.Range{Start: position, End: position}) {
+		return lsp.CallHierarchyItem{}, false
+	}
+
+	return item, true
+}
+
+// OutgoingCalls returns the injected dependencies the component in uri invokes
+// with `<alias>.call` inside its `call` method, in order of first invocation.
+// Every call in the file counts when the component has no `call` method.
+func (s *State) OutgoingCalls(uri string) []lsp.CallHierarchyOutgoingCall {
+	outgoing := []lsp.CallHierarchyOutgoingCall{}
+	if s.Index == nil {
+		return outgoing
+	}
+
+	file, err := s.injectionsIn(uri)
+	if err != nil {
+		return outgoing
+	}
+
+	aliases := map[string]string{}
+	for _, entry := range file.entries {
+		aliases[entry.Alias] = entry.Key
+	}
+
+	index := map[string]int{}
+	for _, call := range file.calls {
+		if !file.invokes(call) {
+			continue
+		}
+
+		key, ok := aliases[call.Receiver]
+		if !ok {
+			continue
+		}
+
+		c, ok := s.resolveDepsKey(key, uri)
+		if !ok {
+			continue
+		}
+
+		i, ok := index[c.URI]
+		if !ok {
+			i = len(outgoing)
+			index[c.URI] = i
+			outgoing = append(outgoing, lsp.CallHierarchyOutgoingCall{To: s.CallHierarchyItem(c)})
+		}
+		outgoing[i].FromRanges = append(outgoing[i].FromRanges, call.Range)
+	}
+
+	return outgoing
+}
+
+// IncomingCalls returns every component that injects the component in uri and
+// invokes it with `<alias>.call`, counted like OutgoingCalls. It stops early
+// with ctx's error once ctx is done.
+func (s *State) IncomingCalls(ctx context.Context, uri string) ([]lsp.CallHierarchyIncomingCall, error) {
+	incoming := []lsp.CallHierarchyIncomingCall{}
+	if s.Index == nil {
+		return incoming, nil
+	}
+
+	target, ok := s.Index.ComponentForURI(uri)
+	if !ok {
+		return incoming, nil
+	}
+
+	injections, err := s.FindInjections(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for _, injection := range injections {
+		if len(injection.Invocations) == 0 {
+			continue
+		}
+
+		caller, ok := s.Index.ComponentForURI(injection.URI)
+		if !ok {
+			continue
+		}
+
+		i, ok := index[injection.URI]
+		if !ok {
+			i = len(incoming)
+			index[injection.URI] = i
+			incoming = append(incoming, lsp.CallHierarchyIncomingCall{From: s.CallHierarchyItem(caller)})
+		}
+		for _, call := range injection.Invocations {
+			incoming[i].FromRanges = append(incoming[i].FromRanges, call.Range)
+		}
+	}
+
+	return incoming, nil
+}
+
+func (s *State) TextDocumentPrepareCallHierarchy(id lsp.ID, uri string, position lsp.Position) lsp.CallHierarchyPrepareResponse {
+	var result []lsp.CallHierarchyItem
+	if item, ok := s.PrepareCallHierarchy(uri, position); ok {
+		result = []lsp.CallHierarchyItem{item}
+	}
+
+	return lsp.CallHierarchyPrepareResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: result,
+	}
+}
+
+func (s *State) CallHierarchyIncomingCalls(ctx context.Context, id lsp.ID, item lsp.CallHierarchyItem) (lsp.CallHierarchyIncomingCallsResponse, error) {
+	incoming, err := s.IncomingCalls(ctx, item.URI)
+	if err != nil {
+		return lsp.CallHierarchyIncomingCallsResponse{}, err
+	}
+
+	return lsp.CallHierarchyIncomingCallsResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: incoming,
+	}, nil
+}
+
+func (s *State) CallHierarchyOutgoingCalls(id lsp.ID, item lsp.CallHierarchyItem) lsp.CallHierarchyOutgoingCallsResponse {
+	return lsp.CallHierarchyOutgoingCallsResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: s.OutgoingCalls(item.URI),
+	}
+}
@@ -0,0 +1,101 @@
+package analysis
+
+import (
+	"context"
+	"hanamilsp/lsp"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestCallHierarchy(t *testing.T) {
+	is := is.New(t)
+
+	state, root := NewTestReferencesState(t)
+	operationURI := root + "/slices/domain/operations/create_goal.rb"
+	transactionURI := root + "/slices/domain/operations/transaction.rb"
+	collaborationURI := root + "/slices/collaborations/operations/queries/get_collaboration.rb"
+
+	transaction := lsp.CallHierarchyItem{
+		Name:           "domain.operations.transaction",
+		Kind:           lsp.SymbolKindClass,
+		Detail:         "Domain::Operations::Transaction",
+		URI:            transactionURI,
+		Range:          lsp.Range{Start: lsp.Position{Line: 2, Character: 4}, End: lsp.Position{Line: 6, Character: 7}},
+		SelectionRange: LineRange(2, 10, 21),
+	}
+
+	t.Run("prepare", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			uri      string
+			position lsp.Position
+			expected string
+		}{
+			{name: "on an injected alias", uri: operationURI, position: lsp.Position{Line: 11, Character: 10}, expected: "domain.operations.transaction"},
+			{name: "on a Deps key", uri: operationURI, position: lsp.Position{Line: 4, Character: 15}, expected: "domain.operations.transaction"},
+			{name: "inside the class body", uri: operationURI, position: lsp.Position{Line: 10, Character: 12}, expected: "domain.operations.create_goal"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				item, ok := state.PrepareCallHierarchy(tc.uri, tc.position)
+				is.True(ok)
+				is.Equal(item.Name, tc.expected)
+			})
+		}
+
+		item, _ := state.PrepareCallHierarchy(operationURI, lsp.Position{Line: 11, Character: 10})
+		is.Equal(item, transaction)
+
+		_, ok := state.PrepareCallHierarchy(operationURI, lsp.Position{Line: 0, Character: 0})
+		is.True(!ok)
+	})
+
+	t.Run("outgoing calls are the dependencies invoked in call", func(t *testing.T) {
+		is.Equal(state.OutgoingCalls(operationURI), []lsp.CallHierarchyOutgoingCall{
+			{To: transaction, FromRanges: []lsp.Range{LineRange(11, 8, 24)}},
+		})
+		is.Equal(state.OutgoingCalls(transactionURI), []lsp.CallHierarchyOutgoingCall{})
+	})
+
+	t.Run("incoming calls are the components that inject and call it", func(t *testing.T) {
+		incoming, err := state.IncomingCalls(context.Background(), transactionURI)
+		is.NoErr(err)
+
+		is.Equal(len(incoming), 2)
+		is.Equal(incoming[0].From.URI, collaborationURI)
+		is.Equal(incoming[0].From.Name, "collaborations.operations.queries.get_collaboration")
+		is.Equal(incoming[0].FromRanges, []lsp.Range{LineRange(7, 10, 26)})
+		is.Equal(incoming[1].From.URI, operationURI)
+		is.Equal(incoming[1].FromRanges, []lsp.Range{LineRange(11, 8, 24)})
+	})
+
+	t.Run("injected but never called components are left out", func(t *testing.T) {
+		incoming, err := state.IncomingCalls(context.Background(), collaborationURI)
+		is.NoErr(err)
+		is.Equal(len(incoming), 0)
+	})
+
+	t.Run("both directions only count calls inside call", func(t *testing.T) {
+		state.OpenDocument(collaborationURI, 2, strings.Replace(testGetCollaboration, "        end\n", "        end\n\n        def fallback(id)\n          transaction.call { id }\n        end\n", 1))
+
+		outgoing := state.OutgoingCalls(collaborationURI)
+		is.Equal(len(outgoing), 1)
+		is.Equal(outgoing[0].FromRanges, []lsp.Range{LineRange(7, 10, 26)})
+
+		incoming, err := state.IncomingCalls(context.Background(), transactionURI)
+		is.NoErr(err)
+		is.Equal(incoming[0].From.URI, collaborationURI)
+		is.Equal(incoming[0].FromRanges, []lsp.Range{LineRange(7, 10, 26)})
+	})
+
+	t.Run("it stops once the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := state.IncomingCalls(ctx, transactionURI)
+		is.Equal(err, context.Canceled)
+	})
+}
@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// Codes of the diagnostics the server reports
+const (
+	DiagnosticUnresolvedKey = "unresolved-key"
+	DiagnosticSliceBoundary = "slice-boundary"
+)
+
+// Diagnostic severities, in the order of their LSP values starting at 1.
+// "off" stops the diagnostic from being reported.
+var Severities = []string{"error", "warning", "information", "hint", "off"}
+
+// Log levels, each one also logs the levels after it
+var LogLevels = []string{"info", "warning", "error", "off"}
+
+// Config is set by the editor, from `initializationOptions` and the
+// `hanamilsp` section of its settings, and may change at any time.
+type Config struct {
+	Slices SliceOptions `json:"slices"`
+	// Map of diagnostic code to whether it is reported, all are by default
+	Diagnostics map[string]bool `json:"diagnostics"`
+	Log         LogConfig       `json:"log"`
+	Index       IndexConfig     `json:"index"`
+	Boundaries  BoundaryConfig  `json:"boundaries"`
+}
+
+type LogConfig struct {
+	// One of LogLevels, "info" by default
+	Level string `json:"level"`
+	// File the log is written to, out.log in the working directory by default
+	Path string `json:"path"`
+}
+
+type IndexConfig struct {
+	// Paths that are not indexed. Patterns containing a slash are matched
+	// against the path relative to the workspace root, others against the
+	// file or directory name, e.g. "spec" or "slices/legacy/*".
+	Exclude []string `json:"exclude"`
+}
+
+type BoundaryConfig struct {
+	// One of Severities, "error" by default
+	Severity string `json:"severity"`
+	// Map of injecting slice to injected slice to the severity overriding
+	// Severity for that pair. Either slice may be "*" to match any slice.
+	Slices map[string]map[string]string `json:"slices"`
+}
+
+// ParseConfig reads each of raws on top of the previous ones, so that later
+// sources only override the settings they contain.
+func ParseConfig(raws ...json.RawMessage) (Config, error) {
+	var config Config
+	var errs []error
+	for _, raw := range raws {
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		if err := json.Unmarshal(raw, &config); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return config, errors.Join(errs...)
+}
+
+// DiagnosticEnabled reports whether diagnostics with the given code are
+// reported.
+func (c Config) DiagnosticEnabled(code string) bool {
+	enabled, ok := c.Diagnostics[code]
+	return !ok || enabled
+}
+
+// severity returns the LSP severity of a boundary violation when slice from
+// injects a key from slice to, or 0 when it is not reported. The most
+// specific setting wins: the exact pair, then any slice injected from from,
+// then from any slice into to, then Severity.
+func (c BoundaryConfig) severity(from, to string) int {
+	for _, name := range []string{
+		c.Slices[from][to],
+		c.Slices[from]["*"],
+		c.Slices["*"][to],
+		c.Severity,
+	} {
+		for i, severity := range Severities {
+			if name == severity {
+				return (i + 1) % len(Severities)
+			}
+		}
+	}
+
+	return 1
+}
+
+// excludes reports whether rel, a slash separated path relative to the
+// workspace root, matches one of the Exclude patterns.
+func (c IndexConfig) excludes(rel string) bool {
+	name := rel[strings.LastIndex(rel, "/")+1:]
+	for _, pattern := range c.Exclude {
+		pattern = strings.Trim(pattern, "/")
+
+		subject := name
+		if strings.Contains(pattern, "/") {
+			subject = rel
+		}
+
+		if ok, _ := filepath.Match(pattern, subject); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"encoding/json"
+	"hanamilsp/lsp"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestParseConfig(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("later sources override the settings they contain", func(t *testing.T) {
+		config, err := ParseConfig(
+			json.RawMessage(`{"slices": {"aliases": {"dom": "domain"}}, "log": {"level": "error", "path": "/tmp/hanamilsp.log"}}`),
+			nil,
+			json.RawMessage(`{"slices": {"aliases": {"collab": "collaborations"}}, "log": {"level": "warning"}}`),
+		)
+		is.NoErr(err)
+
+		is.Equal(config.Slices.Aliases, map[string]string{"dom": "domain", "collab": "collaborations"})
+		is.Equal(config.Log, LogConfig{Level: "warning", Path: "/tmp/hanamilsp.log"})
+	})
+
+	t.Run("diagnostics are enabled unless turned off", func(t *testing.T) {
+		config, err := ParseConfig(json.RawMessage(`{"diagnostics": {"unresolved-key": false}}`))
+		is.NoErr(err)
+
+		is.True(!config.DiagnosticEnabled(DiagnosticUnresolvedKey))
+		is.True(Config{}.DiagnosticEnabled(DiagnosticUnresolvedKey))
+	})
+
+	t.Run("invalid sources are reported", func(t *testing.T) {
+		_, err := ParseConfig(json.RawMessage(`{"index": {"exclude": "spec"}}`))
+		is.True(err != nil)
+	})
+}
+
+func TestSetConfig(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/slices/collaborations.rb":            "module Collaborations\n  class Slice < Hanami::Slice\n    import from: :domain\n  end\nend\n",
+		"slices/domain/operations/transaction.rb":    "",
+		"slices/collaborations/operations/notify.rb": "include Deps[\"core.operations.transaction\", \"operations.missing\"]\n",
+	})
+	uri := "file://" + root + "/slices/collaborations/operations/notify.rb"
+
+	state := NewState(log.New(os.Stdout, "test", 1))
+	state.RootURI = lsp.DocumentURI("file://" + root)
+	state.IndexWorkspace()
+	document, _ := os.ReadFile(URIToPath(uri))
+	state.OpenDocument(uri, 1, string(document))
+
+	t.Run("slice aliases apply without re-indexing", func(t *testing.T) {
+		is.Equal(len(state.Diagnostics(uri)), 2)
+
+		is.True(!state.SetConfig(Config{Slices: SliceOptions{Aliases: map[string]string{"core": "domain"}}}))
+
+		diagnostics := state.Diagnostics(uri)
+		is.Equal(len(diagnostics), 1)
+		is.Equal(diagnostics[0].Code, DiagnosticUnresolvedKey)
+	})
+
+	t.Run("disabled diagnostics are not reported", func(t *testing.T) {
+		state.SetConfig(Config{Diagnostics: map[string]bool{DiagnosticUnresolvedKey: false}})
+		is.Equal(len(state.Diagnostics(uri)), 0)
+	})
+
+	t.Run("changed exclusions need the workspace to be indexed again", func(t *testing.T) {
+		is.True(state.SetConfig(Config{Index: IndexConfig{Exclude: []string{"domain"}}}))
+
+		state.SetIndex(state.RebuildIndex(time.Now(), state.Config.Index))
+		_, ok := state.Index.Lookup("domain", "operations.transaction")
+		is.True(!ok)
+	})
+}
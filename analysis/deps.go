@@ -0,0 +1,147 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// DepsEntry is a single key injected with `include Deps[...]`, either as a
+// plain string or as an aliased `alias: "key"` pair.
+type DepsEntry struct {
+	// Key as written in the Deps list, e.g. "domain.repositories.goal_repo"
+	Key string
+	// Name the dependency is available under inside the class
+	Alias string
+	// True when the entry is written as `alias: "key"`
+	Aliased bool
+	// Range of the key's string content, excluding the quotes
+	Range lsp.Range
+	// Range of the whole string literal, including the quotes
+	StringRange lsp.Range
+}
+
+// ParseDepsEntries returns every entry of every `include Deps[...]` call in
+// document, in source order, using the built-in queries.
+func ParseDepsEntries(document []byte) []DepsEntry {
+	return DepsEntries(queries.Default, parseRuby(document).RootNode(), document)
+}
+
+// DepsEntries is ParseDepsEntries over an already parsed tree.
+func DepsEntries(lib *queries.Library, root *sitter.Node, document []byte) []DepsEntry {
+	q := lib.Get(queries.Deps)
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, root)
+
+	var entries []DepsEntry
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+
+		m = qc.FilterPredicates(m, document)
+
+		var depsNode, refNode *sitter.Node
+		for _, c := range m.Captures {
+			switch q.CaptureNameForId(c.Index) {
+			case "deps":
+				depsNode = c.Node
+			case "deps_ref":
+				refNode = c.Node
+			}
+		}
+
+		if depsNode == nil || refNode == nil {
+			continue
+		}
+
+		entries = append(entries, depsEntriesForNode(refNode, document)...)
+	}
+
+	return entries
+}
+
+func depsEntriesForNode(ref *sitter.Node, document []byte) []DepsEntry {
+	var entries []DepsEntry
+	for i := 0; i < int(ref.NamedChildCount()); i++ {
+		child := ref.NamedChild(i)
+
+		switch child.Type() {
+		case "string":
+			key := stringContent(child, document)
+			entries = append(entries, DepsEntry{
+				Key:         key,
+				Alias:       DefaultAlias(key),
+				Range:       stringContentRange(child, document),
+				StringRange: nodeRange(child, document),
+			})
+		case "pair":
+			keyNode := child.ChildByFieldName("key")
+			valueNode := child.ChildByFieldName("value")
+			if keyNode == nil || valueNode == nil || valueNode.Type() != "string" {
+				continue
+			}
+
+			entries = append(entries, DepsEntry{
+				Key:         stringContent(valueNode, document),
+				Alias:       strings.TrimPrefix(keyNode.Content(document), ":"),
+				Aliased:     true,
+				Range:       stringContentRange(valueNode, document),
+				StringRange: nodeRange(valueNode, document),
+			})
+		}
+	}
+
+	return entries
+}
+
+// DepsEntryAt returns the Deps entry whose key string contains position.
+func DepsEntryAt(entries []DepsEntry, position lsp.Position) (DepsEntry, bool) {
+	for _, e := range entries {
+		if position.Line == e.Range.Start.Line &&
+			position.Character >= e.Range.Start.Character &&
+			position.Character <= e.Range.End.Character {
+			return e, true
+		}
+	}
+
+	return DepsEntry{}, false
+}
+
+// DepsEntryForAlias returns the Deps entry injected under alias.
+func DepsEntryForAlias(entries []DepsEntry, alias string) (DepsEntry, bool) {
+	for _, e := range entries {
+		if e.Alias == alias {
+			return e, true
+		}
+	}
+
+	return DepsEntry{}, false
+}
+
+// DefaultAlias is the name Hanami gives an unaliased dependency, which is the
+// last segment of its key.
+func DefaultAlias(key string) string {
+	return key[strings.LastIndex(key, ".")+1:]
+}
+
+func stringContent(n *sitter.Node, document []byte) string {
+	content := n.Content(document)
+	if len(content) < 2 {
+		return ""
+	}
+
+	return content[1 : len(content)-1]
+}
+
+// stringContentRange is the range between the quotes of a string node.
+func stringContentRange(n *sitter.Node, document []byte) lsp.Range {
+	r := nodeRange(n, document)
+	r.Start.Character++
+	r.End.Character--
+
+	return r
+}
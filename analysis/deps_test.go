@@ -0,0 +1,136 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const testOperation = `module Domain
+  module Operations
+    class CreateGoal
+      include Deps[
+        "operations.transaction",
+        "collaborations.operations.queries.get_collaboration",
+        apply_visibility: "operations.services.apply_visibility",
+        ""
+      ]
+
+      def call(goal)
+        transaction.call do
+          apply_visibility.call(goal)
+        end
+      end
+    end
+  end
+end
+`
+
+func TestParseDepsEntries(t *testing.T) {
+	is := is.New(t)
+
+	entries := ParseDepsEntries([]byte(testOperation))
+
+	is.Equal(entries, []DepsEntry{
+		{
+			Key:         "operations.transaction",
+			Alias:       "transaction",
+			Range:       lsp.Range{Start: lsp.Position{Line: 4, Character: 9}, End: lsp.Position{Line: 4, Character: 31}},
+			StringRange: LineRange(4, 8, 32),
+		},
+		{
+			Key:         "collaborations.operations.queries.get_collaboration",
+			Alias:       "get_collaboration",
+			Range:       lsp.Range{Start: lsp.Position{Line: 5, Character: 9}, End: lsp.Position{Line: 5, Character: 60}},
+			StringRange: LineRange(5, 8, 61),
+		},
+		{
+			Key:         "operations.services.apply_visibility",
+			Alias:       "apply_visibility",
+			Aliased:     true,
+			Range:       lsp.Range{Start: lsp.Position{Line: 6, Character: 27}, End: lsp.Position{Line: 6, Character: 63}},
+			StringRange: LineRange(6, 26, 64),
+		},
+		{
+			Key:         "",
+			Alias:       "",
+			Range:       lsp.Range{Start: lsp.Position{Line: 7, Character: 9}, End: lsp.Position{Line: 7, Character: 9}},
+			StringRange: LineRange(7, 8, 10),
+		},
+	})
+}
+
+func TestDepsEntryAt(t *testing.T) {
+	is := is.New(t)
+
+	entries := ParseDepsEntries([]byte(testOperation))
+
+	e, ok := DepsEntryAt(entries, lsp.Position{Line: 6, Character: 40})
+	is.True(ok)
+	is.Equal(e.Alias, "apply_visibility")
+
+	_, ok = DepsEntryAt(entries, lsp.Position{Line: 10, Character: 10})
+	is.True(!ok)
+}
+
+func TestDepsEntriesUTF16(t *testing.T) {
+	is := is.New(t)
+
+	// 😀 is 4 bytes but 2 UTF-16 code units, é is 2 bytes but 1 code unit
+	document := []byte("# héllo 😀\nLABEL = \"😀é\"; include Deps[\"operations.transaction\"]\ntransaction.call # 😀\n")
+	root := parseRuby(document).RootNode()
+
+	entries := DepsEntries(queries.Default, root, document)
+	is.Equal(len(entries), 1)
+	is.Equal(entries[0].Range, LineRange(1, 29, 51))
+
+	e, ok := DepsEntryAt(entries, lsp.Position{Line: 1, Character: 48})
+	is.True(ok)
+	is.Equal(e.Key, "operations.transaction")
+
+	calls := ParseCalls(queries.Default, root, document)
+	is.Equal(len(calls), 1)
+	is.Equal(calls[0].Range, LineRange(2, 0, 16))
+}
+
+func TestDepsEntryForAlias(t *testing.T) {
+	is := is.New(t)
+
+	entries := ParseDepsEntries([]byte(testOperation))
+
+	e, ok := DepsEntryForAlias(entries, "get_collaboration")
+	is.True(ok)
+	is.Equal(e.Key, "collaborations.operations.queries.get_collaboration")
+
+	// aliases match exactly, not as a pattern
+	_, ok = DepsEntryForAlias(entries, "collaboration")
+	is.True(!ok)
+}
+
+func TestDepsEntriesWithQueryOverride(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	override := `
+(call
+  method: (identifier) @include (#eq? @include "include")
+  arguments: (argument_list
+    (element_reference
+      object: (constant) @deps (#eq? @deps "Import")) @deps_ref))
+`
+	is.NoErr(os.WriteFile(filepath.Join(dir, "deps.scm"), []byte(override), 0o644))
+
+	lib, err := queries.Load(dir)
+	is.NoErr(err)
+
+	document := []byte(strings.Replace(testOperation, "Deps[", "Import[", 1))
+	root := parseRuby(document).RootNode()
+
+	is.Equal(len(DepsEntries(queries.Default, root, document)), 0)
+	is.Equal(len(DepsEntries(lib, root, document)), 4)
+}
@@ -0,0 +1,218 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hanamilsp/lsp"
+	"sort"
+	"strings"
+)
+
+// GraphFormats are the formats FormatGraph renders a dependency graph in.
+var GraphFormats = []string{"json", "dot", "mermaid"}
+
+// DependencyGraph returns every Deps injection between components in the
+// workspace. When slice is set only injections from or into that slice are
+// kept. Nodes are the components found at either end of an injection, sorted
+// by container and key, and edges refer to them by URI since the keys of app
+// and lib components are not qualified. It stops early with ctx's error once
+// ctx is done.
+func (s *State) DependencyGraph(ctx context.Context, slice string) (lsp.DependencyGraph, error) {
+	graph := lsp.DependencyGraph{Nodes: []lsp.DependencyGraphNode{}, Edges: []lsp.DependencyGraphEdge{}}
+	if s.Index == nil {
+		return graph, nil
+	}
+
+	if slice != "" {
+		if _, ok := s.Index.Slices[slice]; !ok {
+			return graph, fmt.Errorf("unknown slice '%s'", slice)
+		}
+	}
+
+	nodes := map[string]Component{}
+	for _, uri := range s.Index.Files {
+		if err := ctx.Err(); err != nil {
+			return graph, err
+		}
+
+		from, ok := s.Index.ComponentForURI(uri)
+		if !ok {
+			continue
+		}
+
+		document, root, err := s.SyntaxTree(uri)
+		if err != nil {
+			s.Logger.Printf("error: unable to read '%s', err: %s", uri, err)
+			continue
+		}
+
+		for _, entry := range DepsEntries(s.Queries, root, document) {
+			to, ok := s.resolveDepsKey(entry.Key, uri)
+			if !ok {
+				continue
+			}
+
+			if slice != "" && from.Container != slice && to.Container != slice {
+				continue
+			}
+
+			nodes[from.URI] = from
+			nodes[to.URI] = to
+			graph.Edges = append(graph.Edges, lsp.DependencyGraphEdge{
+				From:  from.URI,
+				To:    to.URI,
+				Alias: entry.Alias,
+			})
+		}
+	}
+
+	for _, c := range nodes {
+		graph.Nodes = append(graph.Nodes, lsp.DependencyGraphNode{
+			Key:       c.QualifiedKey(),
+			Container: c.Container,
+			ClassName: c.ClassName,
+			URI:       c.URI,
+		})
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		a, b := graph.Nodes[i], graph.Nodes[j]
+		if a.Container != b.Container {
+			return a.Container < b.Container
+		}
+		return a.Key < b.Key
+	})
+
+	return graph, nil
+}
+
+// FormatGraph renders graph as indented JSON, a Graphviz DOT digraph or a
+// Mermaid flowchart, grouping nodes by container in the latter two.
+func FormatGraph(graph lsp.DependencyGraph, format string) (string, error) {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(graph, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	case "dot":
+		return formatDOT(graph), nil
+	case "mermaid":
+		return formatMermaid(graph), nil
+	}
+
+	return "", fmt.Errorf("unknown graph format '%s', expected one of %s", format, strings.Join(GraphFormats, ", "))
+}
+
+func formatDOT(graph lsp.DependencyGraph) string {
+	var b strings.Builder
+	b.WriteString("digraph deps {\n  rankdir=LR;\n")
+
+	ids := nodeIDs(graph)
+	for i, node := range graph.Nodes {
+		if i == 0 || graph.Nodes[i-1].Container != node.Container {
+			fmt.Fprintf(&b, "  subgraph %q {\n    label=%q;\n", "cluster_"+node.Container, node.Container)
+		}
+		fmt.Fprintf(&b, "    %s [label=%q];\n", ids[node.URI], node.Key)
+		if i == len(graph.Nodes)-1 || graph.Nodes[i+1].Container != node.Container {
+			b.WriteString("  }\n")
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s", ids[edge.From], ids[edge.To])
+		if label, ok := edgeLabel(graph, edge); ok {
+			fmt.Fprintf(&b, " [label=%q]", label)
+		}
+		b.WriteString(";\n")
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func formatMermaid(graph lsp.DependencyGraph) string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+
+	ids := nodeIDs(graph)
+	subgraphs := 0
+	for i, node := range graph.Nodes {
+		if i == 0 || graph.Nodes[i-1].Container != node.Container {
+			fmt.Fprintf(&b, "  subgraph s%d [%s]\n", subgraphs, mermaidQuote(node.Container))
+			subgraphs++
+		}
+		fmt.Fprintf(&b, "    %s[%s]\n", ids[node.URI], mermaidQuote(node.Key))
+		if i == len(graph.Nodes)-1 || graph.Nodes[i+1].Container != node.Container {
+			b.WriteString("  end\n")
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		if label, ok := edgeLabel(graph, edge); ok {
+			fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[edge.From], mermaidQuote(label), ids[edge.To])
+		} else {
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[edge.From], ids[edge.To])
+		}
+	}
+
+	return b.String()
+}
+
+// mermaidEscaper replaces the characters that end or format a quoted Mermaid
+// label with their entity codes.
+var mermaidEscaper = strings.NewReplacer("#", "#35;", "\"", "#quot;", "|", "#124;", "<", "#lt;", ">", "#gt;")
+
+// mermaidQuote returns s as a quoted Mermaid label, in which brackets lose
+// their meaning.
+func mermaidQuote(s string) string {
+	return "\"" + mermaidEscaper.Replace(s) + "\""
+}
+
+// nodeIDs maps the URI of each node to an id both formats accept, since keys
+// contain dots and are not unique across the app and lib.
+func nodeIDs(graph lsp.DependencyGraph) map[string]string {
+	ids := map[string]string{}
+	for i, node := range graph.Nodes {
+		ids[node.URI] = fmt.Sprintf("n%d", i)
+	}
+
+	return ids
+}
+
+// edgeLabel returns the alias of edge, unless it is the default alias of the
+// injected key.
+func edgeLabel(graph lsp.DependencyGraph, edge lsp.DependencyGraphEdge) (string, bool) {
+	for _, node := range graph.Nodes {
+		if node.URI == edge.To && DefaultAlias(node.Key) == edge.Alias {
+			return "", false
+		}
+	}
+
+	return edge.Alias, true
+}
+
+func (s *State) HanamiDependencyGraph(ctx context.Context, id lsp.ID, slice string, format string) (lsp.DependencyGraphResponse, error) {
+	graph, err := s.DependencyGraph(ctx, slice)
+	if err != nil {
+		return lsp.DependencyGraphResponse{}, err
+	}
+
+	result := lsp.DependencyGraphResult{DependencyGraph: graph}
+	if format != "" && format != "json" {
+		content, err := FormatGraph(graph, format)
+		if err != nil {
+			return lsp.DependencyGraphResponse{}, err
+		}
+		result.Content = content
+	}
+
+	return lsp.DependencyGraphResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: result,
+	}, nil
+}
@@ -0,0 +1,182 @@
+package analysis
+
+import (
+	"context"
+	"hanamilsp/lsp"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	is := is.New(t)
+
+	state, root := NewTestReferencesState(t)
+	operationURI := root + "/slices/domain/operations/create_goal.rb"
+	transactionURI := root + "/slices/domain/operations/transaction.rb"
+	collaborationURI := root + "/slices/collaborations/operations/queries/get_collaboration.rb"
+
+	t.Run("it collects every injection", func(t *testing.T) {
+		graph, err := state.DependencyGraph(context.Background(), "")
+		is.NoErr(err)
+
+		is.Equal(graph.Nodes, []lsp.DependencyGraphNode{
+			{
+				Key:       "collaborations.operations.queries.get_collaboration",
+				Container: "collaborations",
+				ClassName: "Collaborations::Operations::Queries::GetCollaboration",
+				URI:       collaborationURI,
+			},
+			{
+				Key:       "domain.operations.create_goal",
+				Container: "domain",
+				ClassName: "Domain::Operations::CreateGoal",
+				URI:       operationURI,
+			},
+			{
+				Key:       "domain.operations.transaction",
+				Container: "domain",
+				ClassName: "Domain::Operations::Transaction",
+				URI:       transactionURI,
+			},
+		})
+		is.Equal(graph.Edges, []lsp.DependencyGraphEdge{
+			{From: collaborationURI, To: transactionURI, Alias: "transaction"},
+			{From: operationURI, To: transactionURI, Alias: "transaction"},
+			{From: operationURI, To: collaborationURI, Alias: "get_collaboration"},
+		})
+	})
+
+	t.Run("it scopes the graph to a slice", func(t *testing.T) {
+		graph, err := state.DependencyGraph(context.Background(), "collaborations")
+		is.NoErr(err)
+
+		is.Equal(len(graph.Nodes), 3)
+		is.Equal(graph.Edges, []lsp.DependencyGraphEdge{
+			{From: collaborationURI, To: transactionURI, Alias: "transaction"},
+			{From: operationURI, To: collaborationURI, Alias: "get_collaboration"},
+		})
+	})
+
+	t.Run("it rejects unknown slices", func(t *testing.T) {
+		_, err := state.DependencyGraph(context.Background(), "billing")
+		is.Equal(err.Error(), "unknown slice 'billing'")
+	})
+
+	t.Run("app and lib components with the same key are different nodes", func(t *testing.T) {
+		root := NewTestWorkspace(t, map[string]string{
+			"app/repo.rb":    "module Bookshelf\n  class Repo\n  end\nend\n",
+			"app/create.rb":  "module Bookshelf\n  class Create\n    include Deps[\"repo\"]\n  end\nend\n",
+			"lib/repo.rb":    "class Repo\nend\n",
+			"lib/publish.rb": "class Publish\n  include Deps[\"repo\"]\nend\n",
+		})
+		state := NewState(log.New(io.Discard, "", 0))
+		state.RootURI = lsp.DocumentURI(root)
+		state.IndexWorkspace()
+
+		graph, err := state.DependencyGraph(context.Background(), "")
+		is.NoErr(err)
+		is.Equal(graph.Edges, []lsp.DependencyGraphEdge{
+			{From: root + "/app/create.rb", To: root + "/app/repo.rb", Alias: "repo"},
+			{From: root + "/lib/publish.rb", To: root + "/lib/repo.rb", Alias: "repo"},
+		})
+
+		out, err := FormatGraph(graph, "mermaid")
+		is.NoErr(err)
+		is.Equal(out, `flowchart LR
+  subgraph s0 ["app"]
+    n0["create"]
+    n1["repo"]
+  end
+  subgraph s1 ["lib"]
+    n2["publish"]
+    n3["repo"]
+  end
+  n0 --> n1
+  n2 --> n3
+`)
+	})
+}
+
+func TestFormatGraph(t *testing.T) {
+	is := is.New(t)
+
+	graph := lsp.DependencyGraph{
+		Nodes: []lsp.DependencyGraphNode{
+			{Key: "operations.notify", Container: "app", URI: "file:///app/operations/notify.rb"},
+			{Key: "domain.operations.create_goal", Container: "domain", URI: "file:///slices/domain/operations/create_goal.rb"},
+			{Key: "domain.operations.transaction", Container: "domain", URI: "file:///slices/domain/operations/transaction.rb"},
+		},
+		Edges: []lsp.DependencyGraphEdge{
+			{From: "file:///slices/domain/operations/create_goal.rb", To: "file:///slices/domain/operations/transaction.rb", Alias: "transaction"},
+			{From: "file:///slices/domain/operations/create_goal.rb", To: "file:///app/operations/notify.rb", Alias: "notifier"},
+		},
+	}
+
+	t.Run("dot", func(t *testing.T) {
+		out, err := FormatGraph(graph, "dot")
+		is.NoErr(err)
+		is.Equal(out, `digraph deps {
+  rankdir=LR;
+  subgraph "cluster_app" {
+    label="app";
+    n0 [label="operations.notify"];
+  }
+  subgraph "cluster_domain" {
+    label="domain";
+    n1 [label="domain.operations.create_goal"];
+    n2 [label="domain.operations.transaction"];
+  }
+  n1 -> n2;
+  n1 -> n0 [label="notifier"];
+}
+`)
+	})
+
+	t.Run("mermaid", func(t *testing.T) {
+		out, err := FormatGraph(graph, "mermaid")
+		is.NoErr(err)
+		is.Equal(out, `flowchart LR
+  subgraph s0 ["app"]
+    n0["operations.notify"]
+  end
+  subgraph s1 ["domain"]
+    n1["domain.operations.create_goal"]
+    n2["domain.operations.transaction"]
+  end
+  n1 --> n2
+  n1 -->|"notifier"| n0
+`)
+	})
+
+	t.Run("mermaid labels are escaped", func(t *testing.T) {
+		out, err := FormatGraph(lsp.DependencyGraph{
+			Nodes: []lsp.DependencyGraphNode{
+				{Key: `say["hi"]`, Container: "a|b", URI: "file:///a.rb"},
+			},
+			Edges: []lsp.DependencyGraphEdge{
+				{From: "file:///a.rb", To: "file:///a.rb", Alias: "#<x>|y"},
+			},
+		}, "mermaid")
+		is.NoErr(err)
+		is.Equal(out, `flowchart LR
+  subgraph s0 ["a#124;b"]
+    n0["say[#quot;hi#quot;]"]
+  end
+  n0 -->|"#35;#lt;x#gt;#124;y"| n0
+`)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatGraph(lsp.DependencyGraph{Nodes: []lsp.DependencyGraphNode{}, Edges: []lsp.DependencyGraphEdge{}}, "json")
+		is.NoErr(err)
+		is.Equal(out, "{\n  \"nodes\": [],\n  \"edges\": []\n}\n")
+	})
+
+	t.Run("unknown formats", func(t *testing.T) {
+		_, err := FormatGraph(graph, "svg")
+		is.Equal(err.Error(), "unknown graph format 'svg', expected one of json, dot, mermaid")
+	})
+}
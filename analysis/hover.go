@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"fmt"
+	"hanamilsp/lsp"
+	"strings"
+)
+
+// DescribeComponent renders the markdown shown when hovering a reference to c.
+func (s *State) DescribeComponent(c Component) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "**%s**\n\n", c.ClassName)
+	fmt.Fprintf(&b, "`%s` in `%s`\n", c.QualifiedKey(), strings.TrimPrefix(c.URI, s.Index.RootURI+"/"))
+
+	document, root, err := s.SyntaxTree(c.URI)
+	if err != nil {
+		return b.String()
+	}
+
+	summary, ok := SummarizeClass(s.Queries, root, document, c.ClassName)
+	if !ok {
+		return b.String()
+	}
+
+	if summary.HasCall {
+		fmt.Fprintf(&b, "\n```ruby\ndef call%s\n```\n", summary.CallParameters)
+	}
+
+	if summary.Comment != "" {
+		fmt.Fprintf(&b, "\n%s\n", summary.Comment)
+	}
+
+	return b.String()
+}
+
+func (s *State) TextDocumentHover(id lsp.ID, uri string, position lsp.Position) lsp.HoverResponse {
+	response := lsp.HoverResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+	}
+
+	c, ok := s.ComponentAt(uri, position)
+	if !ok {
+		return response
+	}
+
+	response.Result = &lsp.HoverResult{
+		Contents: lsp.MarkupContent{
+			Kind:  lsp.MarkupKindMarkdown,
+			Value: s.DescribeComponent(c),
+		},
+	}
+
+	return response
+}
@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const testDocumentedTransaction = `# frozen_string_literal: true
+
+module Domain
+  module Operations
+    # Wraps the block in a database transaction.
+    # Rolls back on failure.
+    class Transaction
+      def call(isolation: :default, &block)
+        yield
+      end
+    end
+  end
+end
+`
+
+func TestTextDocumentHover(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"slices/domain/operations/create_goal.rb": testOperation,
+		"slices/domain/operations/transaction.rb": testDocumentedTransaction,
+	})
+	uri := root + "/slices/domain/operations/create_goal.rb"
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	state.RootURI = lsp.DocumentURI(root)
+	state.IndexWorkspace()
+	state.OpenDocument(uri, 1, testOperation)
+
+	expected := "**Domain::Operations::Transaction**\n\n" +
+		"`domain.operations.transaction` in `slices/domain/operations/transaction.rb`\n" +
+		"\n```ruby\ndef call(isolation: :default, &block)\n```\n" +
+		"\nWraps the block in a database transaction.\nRolls back on failure.\n"
+
+	t.Run("on an injected alias", func(t *testing.T) {
+		resp := state.TextDocumentHover(lsp.IntID(1), uri, lsp.Position{Line: 11, Character: 10})
+		is.Equal(resp.Result.Contents, lsp.MarkupContent{Kind: lsp.MarkupKindMarkdown, Value: expected})
+	})
+
+	t.Run("on a Deps key", func(t *testing.T) {
+		resp := state.TextDocumentHover(lsp.IntID(1), uri, lsp.Position{Line: 4, Character: 15})
+		is.Equal(resp.Result.Contents.Value, expected)
+	})
+
+	t.Run("on anything else", func(t *testing.T) {
+		resp := state.TextDocumentHover(lsp.IntID(1), uri, lsp.Position{Line: 10, Character: 12})
+		is.True(resp.Result == nil)
+	})
+}
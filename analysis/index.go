@@ -0,0 +1,374 @@
+package analysis
+
+import (
+	"bufio"
+	"hanamilsp/queries"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// AppContainer is the name used for components registered from app/
+	AppContainer = "app"
+	// LibContainer is the name used for files found under lib/
+	LibContainer = "lib"
+)
+
+// Paths inside a component dir that Hanami does not auto-register by default
+var noAutoRegisterPaths = []string{"entities"}
+
+// Paths inside a slice dir that are not part of its container
+var sliceNonComponentPaths = []string{"config", "db", "templates", "assets"}
+
+var autoRegisterFalseRe = regexp.MustCompile(`^#\s*auto_register:\s*false\s*$`)
+var appModuleRe = regexp.MustCompile(`(?m)^\s*module\s+(\w+)`)
+
+// Component is a single container entry, derived from a file on disk following
+// Hanami's auto-registration rules.
+type Component struct {
+	// Container key relative to its owning container,
+	// e.g. "operations.commands.create_published_goal"
+	Key string
+	// Name of the owning container: AppContainer, LibContainer or a slice name
+	Container string
+	URI       string
+	ClassName string
+}
+
+// QualifiedKey is the key as it would be referenced from another slice,
+// e.g. "domain.operations.transaction".
+func (c Component) QualifiedKey() string {
+	if c.Container == AppContainer || c.Container == LibContainer {
+		return c.Key
+	}
+
+	return c.Container + "." + c.Key
+}
+
+type Index struct {
+	RootURI string
+	AppName string
+	// Map of container name to container key to component
+	Containers map[string]map[string]Component
+	// URIs of every ruby file seen while walking the workspace
+	Files []string
+	// Map of slice name to its import and export declarations
+	Slices map[string]*Slice
+	// Map of key prefix to slice name, overriding imports and slice names
+	Aliases map[string]string
+	// Classes, modules and container keys searched by workspace/symbol,
+	// shared by copies of the index
+	symbols *symbolTable
+}
+
+func NewIndex(rootURI string) *Index {
+	return &Index{
+		RootURI:    strings.TrimSuffix(rootURI, "/"),
+		Containers: map[string]map[string]Component{},
+		Slices:     map[string]*Slice{},
+		Aliases:    map[string]string{},
+		symbols:    &symbolTable{lib: queries.Default},
+	}
+}
+
+// BuildIndex walks the workspace at rootURI and registers every component in
+// the app, each slice under slices/ and lib/, skipping excluded paths.
+func BuildIndex(lib *queries.Library, rootURI string, config IndexConfig) (*Index, error) {
+	idx := NewIndex(rootURI)
+	root := URIToPath(idx.RootURI)
+
+	idx.AppName = readAppName(root)
+	idx.symbols.lib = lib
+	idx.Slices = DiscoverSlices(lib, root)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" || name == "tmp" || config.excludes(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if filepath.Ext(path) != ".rb" || config.excludes(rel) {
+			return nil
+		}
+
+		idx.Add(rel)
+		return nil
+	})
+
+	sort.Strings(idx.Files)
+	return idx, err
+}
+
+// Add registers the ruby file at rel, a slash separated path relative to the
+// workspace root.
+func (idx *Index) Add(rel string) {
+	uri := idx.RootURI + "/" + rel
+	idx.Files = append(idx.Files, uri)
+
+	component, ok := idx.componentForPath(rel)
+	if !ok || !isAutoRegistered(URIToPath(uri)) {
+		return
+	}
+
+	if idx.Containers[component.Container] == nil {
+		idx.Containers[component.Container] = map[string]Component{}
+	}
+	idx.Containers[component.Container][component.Key] = component
+}
+
+func (idx *Index) componentForPath(rel string) (Component, bool) {
+	segments := strings.Split(strings.TrimSuffix(rel, ".rb"), "/")
+
+	var container, namespace string
+	var keySegments []string
+
+	switch {
+	case segments[0] == "app" && len(segments) > 1:
+		container = AppContainer
+		namespace = idx.AppName
+		keySegments = segments[1:]
+		if containsPath(noAutoRegisterPaths, keySegments[0]) && len(keySegments) > 1 {
+			return Component{}, false
+		}
+	case segments[0] == "slices" && len(segments) > 2:
+		container = segments[1]
+		namespace = Camelize(segments[1])
+		keySegments = segments[2:]
+		if len(keySegments) > 1 && (containsPath(noAutoRegisterPaths, keySegments[0]) || containsPath(sliceNonComponentPaths, keySegments[0])) {
+			return Component{}, false
+		}
+	case segments[0] == "lib" && len(segments) > 1:
+		container = LibContainer
+		keySegments = segments[1:]
+	default:
+		return Component{}, false
+	}
+
+	constants := make([]string, 0, len(keySegments)+1)
+	if namespace != "" {
+		constants = append(constants, namespace)
+	}
+	for _, s := range keySegments {
+		constants = append(constants, Camelize(s))
+	}
+
+	return Component{
+		Key:       strings.Join(keySegments, "."),
+		Container: container,
+		URI:       idx.RootURI + "/" + rel,
+		ClassName: strings.Join(constants, "::"),
+	}, true
+}
+
+// Lookup returns the component registered under key in the named container.
+func (idx *Index) Lookup(container, key string) (Component, bool) {
+	c, ok := idx.Containers[container][key]
+	return c, ok
+}
+
+// Resolve finds the component that key refers to when it is used from inside
+// the container named from. Keys prefixed with a slice alias resolve in that
+// slice, anything else resolves locally.
+func (idx *Index) Resolve(key string, from string) (Component, bool) {
+	key = strings.Trim(key, " \",")
+
+	prefix, rest, found := strings.Cut(key, ".")
+	if found {
+		if slice, ok := idx.SliceForPrefix(from, prefix); ok {
+			if c, ok := idx.Lookup(slice, rest); ok {
+				return c, true
+			}
+		}
+	}
+
+	return idx.Lookup(from, key)
+}
+
+// ContainerForURI returns the name of the container that owns the file at uri.
+func (idx *Index) ContainerForURI(uri string) (string, bool) {
+	rel, found := strings.CutPrefix(uri, idx.RootURI+"/")
+	if !found {
+		return "", false
+	}
+
+	segments := strings.Split(rel, "/")
+	switch {
+	case segments[0] == "app":
+		return AppContainer, true
+	case segments[0] == "lib":
+		return LibContainer, true
+	case segments[0] == "slices" && len(segments) > 2:
+		return segments[1], true
+	}
+
+	return "", false
+}
+
+// ContainerRootURI returns the uri of the directory holding the named
+// container's components.
+func (idx *Index) ContainerRootURI(container string) string {
+	switch container {
+	case AppContainer:
+		return idx.RootURI + "/app"
+	case LibContainer:
+		return idx.RootURI + "/lib"
+	}
+
+	return idx.RootURI + "/slices/" + container
+}
+
+// ComponentForURI returns the component defined by the file at uri.
+func (idx *Index) ComponentForURI(uri string) (Component, bool) {
+	rel, found := strings.CutPrefix(uri, idx.RootURI+"/")
+	if !found {
+		return Component{}, false
+	}
+
+	c, ok := idx.componentForPath(rel)
+	if !ok {
+		return Component{}, false
+	}
+
+	return idx.Lookup(c.Container, c.Key)
+}
+
+// Keys returns the sorted container keys registered in the named container.
+func (idx *Index) Keys(container string) []string {
+	keys := make([]string, 0, len(idx.Containers[container]))
+	for k := range idx.Containers[container] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// SliceNames returns the sorted names of every slice found in the workspace.
+func (idx *Index) SliceNames() []string {
+	var names []string
+	for name := range idx.Slices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func readAppName(root string) string {
+	b, err := os.ReadFile(filepath.Join(root, "config", "app.rb"))
+	if err == nil {
+		if m := appModuleRe.FindSubmatch(b); m != nil {
+			return string(m[1])
+		}
+	}
+
+	return Camelize(filepath.Base(root))
+}
+
+// isAutoRegistered checks for the `# auto_register: false` magic comment at
+// the top of a file.
+func isAutoRegistered(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if autoRegisterFalseRe.MatchString(line) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsPath(paths []string, segment string) bool {
+	for _, p := range paths {
+		if p == segment {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Camelize converts a snake_case file or directory name into its constant
+// name, e.g. "create_published_goal" => "CreatePublishedGoal".
+func Camelize(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]))
+		b.WriteString(part[1:])
+	}
+
+	return b.String()
+}
+
+// Underscore is the inverse of Camelize, e.g. "CreatePublishedGoal" =>
+// "create_published_goal".
+func Underscore(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// URIToPath returns the filesystem path of a file:// uri, with its escaped
+// characters, e.g. spaces sent as %20, decoded.
+func URIToPath(uri string) string {
+	path := strings.TrimPrefix(uri, "file://")
+	if decoded, err := url.PathUnescape(path); err == nil {
+		return decoded
+	}
+
+	return path
+}
+
+// PathToURI returns the file:// uri of an absolute path, the reverse of
+// URIToPath.
+func PathToURI(path string) string {
+	return "file://" + (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath()
+}
@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"hanamilsp/queries"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func NewTestWorkspace(t testing.TB, files map[string]string) string {
+	root := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create fixture dir: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("could not write fixture file: %s", err)
+		}
+	}
+
+	return root
+}
+
+func TestBuildIndex(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/app.rb":                                                 "module GoalsService\n  class App < Hanami::App\n  end\nend\n",
+		"app/actions/goals/index.rb":                                    "",
+		"app/entities/goal.rb":                                          "",
+		"lib/goals_service/types.rb":                                    "",
+		"slices/domain/operations/transaction.rb":                       "",
+		"slices/domain/operations/commands/create_published_goal.rb":    "",
+		"slices/domain/config/routes.rb":                                "",
+		"slices/domain/operations/legacy.rb":                            "# frozen_string_literal: true\n# auto_register: false\n",
+		"slices/collaborations/operations/queries/get_collaboration.rb": "",
+	})
+
+	idx, err := BuildIndex(queries.Default, root, IndexConfig{})
+	is.NoErr(err)
+
+	t.Run("it registers app components under the app namespace", func(t *testing.T) {
+		c, ok := idx.Lookup(AppContainer, "actions.goals.index")
+		is.True(ok)
+		is.Equal(c.ClassName, "GoalsService::Actions::Goals::Index")
+		is.Equal(c.URI, root+"/app/actions/goals/index.rb")
+	})
+
+	t.Run("it registers slice components under the slice namespace", func(t *testing.T) {
+		c, ok := idx.Lookup("domain", "operations.commands.create_published_goal")
+		is.True(ok)
+		is.Equal(c.ClassName, "Domain::Operations::Commands::CreatePublishedGoal")
+		is.Equal(c.QualifiedKey(), "domain.operations.commands.create_published_goal")
+	})
+
+	t.Run("it registers lib files", func(t *testing.T) {
+		c, ok := idx.Lookup(LibContainer, "goals_service.types")
+		is.True(ok)
+		is.Equal(c.ClassName, "GoalsService::Types")
+	})
+
+	t.Run("it skips files that are not auto-registered", func(t *testing.T) {
+		_, ok := idx.Lookup(AppContainer, "entities.goal")
+		is.True(!ok)
+		_, ok = idx.Lookup("domain", "config.routes")
+		is.True(!ok)
+		_, ok = idx.Lookup("domain", "operations.legacy")
+		is.True(!ok)
+	})
+
+	t.Run("it resolves local and cross-slice keys", func(t *testing.T) {
+		c, ok := idx.Resolve("operations.transaction", "domain")
+		is.True(ok)
+		is.Equal(c.URI, root+"/slices/domain/operations/transaction.rb")
+
+		c, ok = idx.Resolve("collaborations.operations.queries.get_collaboration", "domain")
+		is.True(ok)
+		is.Equal(c.Container, "collaborations")
+
+		_, ok = idx.Resolve("operations.transaction", "collaborations")
+		is.True(!ok)
+	})
+
+	t.Run("it finds the container for a uri", func(t *testing.T) {
+		container, ok := idx.ContainerForURI(root + "/slices/collaborations/operations/queries/get_collaboration.rb")
+		is.True(ok)
+		is.Equal(container, "collaborations")
+	})
+
+	t.Run("it lists slice names", func(t *testing.T) {
+		is.Equal(idx.SliceNames(), []string{"collaborations", "domain"})
+	})
+
+	t.Run("it skips excluded paths", func(t *testing.T) {
+		idx, err := BuildIndex(queries.Default, root, IndexConfig{Exclude: []string{"slices/collaborations/", "commands", "app/*/goals"}})
+		is.NoErr(err)
+
+		_, ok := idx.Lookup("domain", "operations.transaction")
+		is.True(ok)
+		_, ok = idx.Lookup("domain", "operations.commands.create_published_goal")
+		is.True(!ok)
+		_, ok = idx.Lookup("collaborations", "operations.queries.get_collaboration")
+		is.True(!ok)
+		_, ok = idx.Lookup(AppContainer, "actions.goals.index")
+		is.True(!ok)
+	})
+}
+
+func TestBuildIndexFromFileURI(t *testing.T) {
+	is := is.New(t)
+
+	base := NewTestWorkspace(t, map[string]string{
+		"goals service/config/app.rb":             "module GoalsService\n  class App < Hanami::App\n  end\nend\n",
+		"goals service/app/actions/goals/show.rb": "",
+	})
+	root := filepath.Join(base, "goals service")
+	rootURI := PathToURI(root)
+	is.True(strings.Contains(rootURI, "goals%20service"))
+
+	idx, err := BuildIndex(queries.Default, rootURI, IndexConfig{})
+	is.NoErr(err)
+
+	c, ok := idx.Lookup(AppContainer, "actions.goals.show")
+	is.True(ok)
+	is.Equal(c.ClassName, "GoalsService::Actions::Goals::Show")
+	is.Equal(c.URI, rootURI+"/app/actions/goals/show.rb")
+	is.Equal(URIToPath(c.URI), filepath.Join(root, "app", "actions", "goals", "show.rb"))
+}
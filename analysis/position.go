@@ -0,0 +1,105 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"strings"
+	"unicode/utf8"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// LSP positions count characters in UTF-16 code units, while tree-sitter and
+// Go strings work in bytes. These helpers convert between the two.
+
+// OffsetForPosition returns the byte offset of position in text. Positions
+// past the end of a line clamp to the end of that line, and positions past
+// the end of the text clamp to its length.
+func OffsetForPosition(text string, position lsp.Position) int {
+	offset := 0
+	for line := 0; line < position.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+
+	units := 0
+	for offset < len(text) && text[offset] != '\n' && units < position.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		units += utf16Len(r)
+		offset += size
+	}
+
+	return offset
+}
+
+// PositionForOffset is the inverse of OffsetForPosition.
+func PositionForOffset(text string, offset int) lsp.Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+
+	var position lsp.Position
+	lineStart := 0
+	for i := 0; i < offset; i++ {
+		if text[i] == '\n' {
+			position.Line++
+			lineStart = i + 1
+		}
+	}
+
+	for _, r := range text[lineStart:offset] {
+		position.Character += utf16Len(r)
+	}
+
+	return position
+}
+
+// PointForOffset returns the tree-sitter point, with a byte column, of the
+// byte offset in text.
+func PointForOffset(text string, offset int) sitter.Point {
+	var point sitter.Point
+	lineStart := 0
+	for i := 0; i < offset && i < len(text); i++ {
+		if text[i] == '\n' {
+			point.Row++
+			lineStart = i + 1
+		}
+	}
+	point.Column = uint32(offset - lineStart)
+
+	return point
+}
+
+// positionForPoint returns the position of the tree-sitter point at the byte
+// offset in document, converting its byte column to UTF-16 code units.
+func positionForPoint(document []byte, offset uint32, point sitter.Point) lsp.Position {
+	lineStart := offset - point.Column
+
+	units := 0
+	for _, r := range string(document[lineStart:offset]) {
+		units += utf16Len(r)
+	}
+
+	return lsp.Position{Line: int(point.Row), Character: units}
+}
+
+// utf16Len is the number of UTF-16 code units needed to encode r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
+
+// positionBefore reports whether a comes strictly before b.
+func positionBefore(a, b lsp.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+}
+
+// rangeContains reports whether inner lies within outer.
+func rangeContains(outer, inner lsp.Range) bool {
+	return !positionBefore(inner.Start, outer.Start) && !positionBefore(outer.End, inner.End)
+}
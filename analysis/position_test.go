@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestOffsetForPosition(t *testing.T) {
+	is := is.New(t)
+
+	// "é" is 2 bytes and 1 UTF-16 unit, "𝄞" is 4 bytes and 2 UTF-16 units
+	text := "a = 1\nb = \"é𝄞\" + c\n"
+
+	testCases := []struct {
+		position lsp.Position
+		offset   int
+	}{
+		{position: lsp.Position{Line: 0, Character: 0}, offset: 0},
+		{position: lsp.Position{Line: 0, Character: 99}, offset: 5},
+		{position: lsp.Position{Line: 1, Character: 5}, offset: 11},
+		{position: lsp.Position{Line: 1, Character: 6}, offset: 13},
+		{position: lsp.Position{Line: 1, Character: 8}, offset: 17},
+		{position: lsp.Position{Line: 1, Character: 13}, offset: 22},
+		{position: lsp.Position{Line: 2, Character: 0}, offset: 23},
+		{position: lsp.Position{Line: 9, Character: 0}, offset: 23},
+	}
+
+	for _, tc := range testCases {
+		is.Equal(OffsetForPosition(text, tc.position), tc.offset)
+	}
+
+	is.Equal(PositionForOffset(text, 17), lsp.Position{Line: 1, Character: 8})
+	is.Equal(PositionForOffset(text, 13), lsp.Position{Line: 1, Character: 6})
+}
+
+func TestUpdateDocument(t *testing.T) {
+	is := is.New(t)
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	uri := "file:///operation.rb"
+	state.OpenDocument(uri, 1, "class Foo\n  include Deps[\"é.transaction\"]\nend\n")
+
+	state.UpdateDocument(uri, 2, []lsp.TextDocumentContentChangeEvent{
+		{
+			Range: &lsp.Range{Start: lsp.Position{Line: 1, Character: 16}, End: lsp.Position{Line: 1, Character: 17}},
+			Text:  "operations",
+		},
+		{
+			Range: &lsp.Range{Start: lsp.Position{Line: 2, Character: 0}, End: lsp.Position{Line: 2, Character: 0}},
+			Text:  "  def call; end\n",
+		},
+	})
+
+	expected := "class Foo\n  include Deps[\"operations.transaction\"]\n  def call; end\nend\n"
+	is.Equal(state.Documents[uri], expected)
+	is.Equal(state.Versions[uri], 2)
+	is.Equal(state.Trees[uri].RootNode().String(), parseRuby([]byte(expected)).RootNode().String())
+
+	state.UpdateDocument(uri, 3, []lsp.TextDocumentContentChangeEvent{{Text: "module Bar\nend\n"}})
+	is.Equal(state.Documents[uri], "module Bar\nend\n")
+	is.Equal(state.Trees[uri].RootNode().String(), parseRuby([]byte("module Bar\nend\n")).RootNode().String())
+}
+
+func TestConcurrentSyntaxTree(t *testing.T) {
+	is := is.New(t)
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	uri := "file:///operation.rb"
+	state.OpenDocument(uri, 1, strings.Repeat("transaction.call\n", 200))
+
+	// Every reader looks up nodes that were not looked up before, each of
+	// which go-tree-sitter caches in its tree
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				document, root, err := state.SyntaxTree(uri)
+				is.NoErr(err)
+				_, ok := CallAt(root, document, lsp.Position{Line: (i + g*25) % 200, Character: 3})
+				is.True(ok)
+			}
+		}()
+	}
+
+	for version := 2; version < 20; version++ {
+		state.UpdateDocument(uri, version, []lsp.TextDocumentContentChangeEvent{{
+			Range: &lsp.Range{Start: lsp.Position{Line: 0, Character: 0}, End: lsp.Position{Line: 0, Character: 0}},
+			Text:  "transaction.call\n",
+		}})
+	}
+	wg.Wait()
+}
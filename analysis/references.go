@@ -0,0 +1,200 @@
+package analysis
+
+import (
+	"context"
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Injection is a single `include Deps[...]` entry that injects a component,
+// together with every `<alias>.call` made on it in the same file.
+type Injection struct {
+	URI   string
+	Entry DepsEntry
+	Calls []Call
+	// Calls made inside the `call` method of the injecting class, or anywhere
+	// in the file when it has none
+	Invocations []Call
+}
+
+// fileInjections are the Deps entries of a file and the `<alias>.call` calls
+// made in it.
+type fileInjections struct {
+	entries []DepsEntry
+	calls   []Call
+	// Range of the file's `call` method, nil when it has none
+	callMethod *lsp.Range
+}
+
+func parseInjections(lib *queries.Library, root *sitter.Node, document []byte) fileInjections {
+	file := fileInjections{entries: DepsEntries(lib, root, document)}
+	if len(file.entries) == 0 {
+		return file
+	}
+
+	for _, call := range ParseCalls(lib, root, document) {
+		if call.Method == "call" {
+			file.calls = append(file.calls, call)
+		}
+	}
+
+	if name := findMethodName(lib, root, document, "call"); name != nil {
+		r := nodeRange(name.Parent(), document)
+		file.callMethod = &r
+	}
+
+	return file
+}
+
+// invokes reports whether call is made inside the file's `call` method, or
+// anywhere when it has none.
+func (f fileInjections) invokes(call Call) bool {
+	return f.callMethod == nil || rangeContains(*f.callMethod, call.Range)
+}
+
+// injectionsIn returns the Deps entries and calls of uri. Open documents are
+// parsed as they are, other files come from the index's table unless they
+// changed after it was built.
+func (s *State) injectionsIn(uri string) (fileInjections, error) {
+	s.mu.RLock()
+	_, open := s.Documents[uri]
+	changedAt := s.changed[uri]
+	s.mu.RUnlock()
+
+	if !open {
+		if file, ok := s.Index.symbols.injections(s.Index, uri); ok && !s.Index.symbols.loadedAt.Before(changedAt) {
+			return file, nil
+		}
+	}
+
+	document, root, err := s.SyntaxTree(uri)
+	if err != nil {
+		return fileInjections{}, err
+	}
+
+	return parseInjections(s.Queries, root, document), nil
+}
+
+// ComponentAt returns the component referred to at position in uri, which is
+// either a Deps key, the alias of an injected dependency, or the name of the
+// class declared in a component file.
+func (s *State) ComponentAt(uri string, position lsp.Position) (Component, bool) {
+	if s.Index == nil {
+		return Component{}, false
+	}
+
+	document, root, err := s.SyntaxTree(uri)
+	if err != nil {
+		return Component{}, false
+	}
+
+	entries := DepsEntries(s.Queries, root, document)
+	if entry, ok := DepsEntryAt(entries, position); ok {
+		return s.resolveDepsKey(entry.Key, uri)
+	}
+
+	if _, ok := classNameAt(root, document, position); ok {
+		return s.Index.ComponentForURI(uri)
+	}
+
+	if alias, ok := identifierAt(root, document, position); ok {
+		for _, entry := range entries {
+			if entry.Alias == alias {
+				return s.resolveDepsKey(entry.Key, uri)
+			}
+		}
+	}
+
+	return Component{}, false
+}
+
+func (s *State) resolveDepsKey(key string, fromURI string) (Component, bool) {
+	container, ok := s.Index.ContainerForURI(fromURI)
+	if !ok {
+		return Component{}, false
+	}
+
+	return s.Index.Resolve(key, container)
+}
+
+// FindInjections returns each Deps entry in the workspace that resolves to
+// target. It stops early with ctx's error once ctx is done.
+func (s *State) FindInjections(ctx context.Context, target Component) ([]Injection, error) {
+	var injections []Injection
+	for _, uri := range s.Index.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		file, err := s.injectionsIn(uri)
+		if err != nil {
+			s.Logger.Printf("error: unable to read '%s', err: %s", uri, err)
+			continue
+		}
+
+		for _, entry := range file.entries {
+			c, ok := s.resolveDepsKey(entry.Key, uri)
+			if !ok || c.URI != target.URI {
+				continue
+			}
+
+			injection := Injection{URI: uri, Entry: entry}
+			for _, call := range file.calls {
+				if call.Receiver != entry.Alias {
+					continue
+				}
+
+				injection.Calls = append(injection.Calls, call)
+				if file.invokes(call) {
+					injection.Invocations = append(injection.Invocations, call)
+				}
+			}
+
+			injections = append(injections, injection)
+		}
+	}
+
+	return injections, nil
+}
+
+func (s *State) TextDocumentReferences(ctx context.Context, id lsp.ID, uri string, position lsp.Position, includeDeclaration bool) (lsp.ReferencesResponse, error) {
+	locations := []lsp.Location{}
+
+	response := lsp.ReferencesResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: locations,
+	}
+
+	target, ok := s.ComponentAt(uri, position)
+	if !ok {
+		return response, nil
+	}
+
+	if includeDeclaration {
+		if document, root, err := s.SyntaxTree(target.URI); err == nil {
+			if r, ok := FindClassDeclaration(s.Queries, root, document, target.ClassName); ok {
+				locations = append(locations, lsp.Location{URI: target.URI, Range: r})
+			}
+		}
+	}
+
+	injections, err := s.FindInjections(ctx, target)
+	if err != nil {
+		return lsp.ReferencesResponse{}, err
+	}
+
+	for _, injection := range injections {
+		locations = append(locations, lsp.Location{URI: injection.URI, Range: injection.Entry.Range})
+		for _, call := range injection.Calls {
+			locations = append(locations, lsp.Location{URI: injection.URI, Range: call.Range})
+		}
+	}
+
+	response.Result = locations
+	return response, nil
+}
@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"context"
+	"hanamilsp/lsp"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const testTransaction = `module Domain
+  module Operations
+    class Transaction
+      def call
+        yield
+      end
+    end
+  end
+end
+`
+
+const testGetCollaboration = `module Collaborations
+  module Operations
+    module Queries
+      class GetCollaboration
+        include Deps["domain.operations.transaction"]
+
+        def call(id)
+          transaction.call { id }
+        end
+      end
+    end
+  end
+end
+`
+
+func NewTestReferencesState(t *testing.T) (*State, string) {
+	root := NewTestWorkspace(t, map[string]string{
+		"slices/domain/operations/create_goal.rb":                       testOperation,
+		"slices/domain/operations/transaction.rb":                       testTransaction,
+		"slices/collaborations/operations/queries/get_collaboration.rb": testGetCollaboration,
+	})
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	state.RootURI = lsp.DocumentURI(root)
+	state.IndexWorkspace()
+
+	return state, root
+}
+
+func TestTextDocumentReferences(t *testing.T) {
+	is := is.New(t)
+
+	state, root := NewTestReferencesState(t)
+	operationURI := root + "/slices/domain/operations/create_goal.rb"
+	transactionURI := root + "/slices/domain/operations/transaction.rb"
+	collaborationURI := root + "/slices/collaborations/operations/queries/get_collaboration.rb"
+
+	expected := []lsp.Location{
+		{URI: collaborationURI, Range: LineRange(4, 22, 51)},
+		{URI: collaborationURI, Range: LineRange(7, 10, 26)},
+		{URI: operationURI, Range: LineRange(4, 9, 31)},
+		{URI: operationURI, Range: LineRange(11, 8, 24)},
+	}
+
+	testCases := []struct {
+		name     string
+		uri      string
+		position lsp.Position
+	}{
+		{
+			name:     "on the class declaration",
+			uri:      transactionURI,
+			position: lsp.Position{Line: 2, Character: 12},
+		},
+		{
+			name:     "on a Deps key",
+			uri:      operationURI,
+			position: lsp.Position{Line: 4, Character: 15},
+		},
+		{
+			name:     "on an injected alias",
+			uri:      operationURI,
+			position: lsp.Position{Line: 11, Character: 10},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := state.TextDocumentReferences(context.Background(), lsp.IntID(1), tc.uri, tc.position, false)
+			is.NoErr(err)
+			is.Equal(resp.Result, expected)
+		})
+	}
+
+	t.Run("it includes the declaration when asked to", func(t *testing.T) {
+		resp, err := state.TextDocumentReferences(context.Background(), lsp.IntID(1), operationURI, lsp.Position{Line: 4, Character: 15}, true)
+		is.NoErr(err)
+		is.Equal(resp.Result[0], lsp.Location{URI: transactionURI, Range: LineRange(2, 10, 21)})
+		is.Equal(len(resp.Result), 5)
+	})
+
+	t.Run("it reads closed files from the index", func(t *testing.T) {
+		file, ok := state.Index.symbols.injections(state.Index, collaborationURI)
+		is.True(ok)
+		is.Equal(len(file.entries), 1)
+		is.Equal(file.calls[0].Range, LineRange(7, 10, 26))
+	})
+
+	t.Run("it reads files changed since the index was built from disk", func(t *testing.T) {
+		changed := strings.Replace(testGetCollaboration, "transaction.call { id }", "transaction.call { id }\n          transaction.call { id }", 1)
+		is.NoErr(os.WriteFile(URIToPath(collaborationURI), []byte(changed), 0o644))
+		state.FileChanged(collaborationURI)
+
+		resp, err := state.TextDocumentReferences(context.Background(), lsp.IntID(1), operationURI, lsp.Position{Line: 4, Character: 15}, false)
+		is.NoErr(err)
+		is.Equal(len(resp.Result), 5)
+		is.Equal(resp.Result[2], lsp.Location{URI: collaborationURI, Range: LineRange(8, 10, 26)})
+	})
+
+	t.Run("it returns nothing when not on a component", func(t *testing.T) {
+		resp, err := state.TextDocumentReferences(context.Background(), lsp.IntID(1), operationURI, lsp.Position{Line: 10, Character: 12}, false)
+		is.NoErr(err)
+		is.Equal(len(resp.Result), 0)
+	})
+}
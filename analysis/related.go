@@ -0,0 +1,101 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	RelatedKindAction   = "action"
+	RelatedKindView     = "view"
+	RelatedKindTemplate = "template"
+)
+
+// RelatedFiles returns the action, view and templates that belong together
+// with the file at uri, e.g. actions/goals/show.rb, views/goals/show.rb and
+// templates/goals/show.html.erb in the same slice.
+func (s *State) RelatedFiles(uri string) []lsp.RelatedFile {
+	related := []lsp.RelatedFile{}
+	if s.Index == nil {
+		return related
+	}
+
+	container, ok := s.Index.ContainerForURI(uri)
+	if !ok {
+		return related
+	}
+
+	containerRoot := s.Index.ContainerRootURI(container)
+	rel, found := strings.CutPrefix(uri, containerRoot+"/")
+	if !found {
+		return related
+	}
+
+	kind, name, found := strings.Cut(rel, "/")
+	if !found {
+		return related
+	}
+
+	switch kind {
+	case "actions", "views":
+		name = strings.TrimSuffix(name, ".rb")
+	case "templates":
+		// show.html.erb => show
+		dir, file := filepath.Split(name)
+		name = dir + strings.Split(file, ".")[0]
+	default:
+		return related
+	}
+
+	addIfExists := func(kind, uri string) {
+		if _, err := StatURI(uri); err == nil {
+			related = append(related, lsp.RelatedFile{Kind: kind, Location: lsp.Location{URI: uri}})
+		}
+	}
+
+	if kind != "actions" {
+		addIfExists(RelatedKindAction, containerRoot+"/actions/"+name+".rb")
+	}
+
+	if kind != "views" {
+		addIfExists(RelatedKindView, containerRoot+"/views/"+name+".rb")
+	}
+
+	if kind != "templates" {
+		templates, _ := filepath.Glob(URIToPath(containerRoot+"/templates/"+name) + ".*")
+		sort.Strings(templates)
+		for _, path := range templates {
+			templateURI := containerRoot + "/templates/" + name + strings.TrimPrefix(path, URIToPath(containerRoot+"/templates/"+name))
+			related = append(related, lsp.RelatedFile{Kind: RelatedKindTemplate, Location: lsp.Location{URI: templateURI}})
+		}
+	}
+
+	return related
+}
+
+func (s *State) HanamiRelatedFiles(id lsp.ID, uri string) lsp.RelatedFilesResponse {
+	return lsp.RelatedFilesResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: s.RelatedFiles(uri),
+	}
+}
+
+func (s *State) TextDocumentImplementation(id lsp.ID, uri string) lsp.ImplementationResponse {
+	locations := []lsp.Location{}
+	for _, r := range s.RelatedFiles(uri) {
+		locations = append(locations, r.Location)
+	}
+
+	return lsp.ImplementationResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: locations,
+	}
+}
@@ -0,0 +1,50 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestRelatedFiles(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"slices/domain/actions/goals/show.rb":          "",
+		"slices/domain/views/goals/show.rb":            "",
+		"slices/domain/templates/goals/show.html.erb":  "",
+		"slices/domain/templates/goals/show.turbo.erb": "",
+		"slices/domain/templates/goals/index.html.erb": "",
+		"app/actions/home/show.rb":                     "",
+	})
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	state.RootURI = lsp.DocumentURI(root)
+	state.IndexWorkspace()
+
+	action := lsp.RelatedFile{Kind: RelatedKindAction, Location: lsp.Location{URI: root + "/slices/domain/actions/goals/show.rb"}}
+	view := lsp.RelatedFile{Kind: RelatedKindView, Location: lsp.Location{URI: root + "/slices/domain/views/goals/show.rb"}}
+	html := lsp.RelatedFile{Kind: RelatedKindTemplate, Location: lsp.Location{URI: root + "/slices/domain/templates/goals/show.html.erb"}}
+	turbo := lsp.RelatedFile{Kind: RelatedKindTemplate, Location: lsp.Location{URI: root + "/slices/domain/templates/goals/show.turbo.erb"}}
+
+	t.Run("from an action", func(t *testing.T) {
+		is.Equal(state.RelatedFiles(action.URI), []lsp.RelatedFile{view, html, turbo})
+	})
+
+	t.Run("from a view", func(t *testing.T) {
+		is.Equal(state.RelatedFiles(view.URI), []lsp.RelatedFile{action, html, turbo})
+	})
+
+	t.Run("from a template", func(t *testing.T) {
+		is.Equal(state.RelatedFiles(html.URI), []lsp.RelatedFile{action, view})
+	})
+
+	t.Run("when nothing is related", func(t *testing.T) {
+		is.Equal(state.RelatedFiles(root+"/app/actions/home/show.rb"), []lsp.RelatedFile{})
+	})
+}
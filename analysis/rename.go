@@ -0,0 +1,195 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"hanamilsp/lsp"
+	"regexp"
+	"strings"
+)
+
+var keySegmentRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+var constantRe = regexp.MustCompile(`^[A-Z][A-Za-z0-9_]*$`)
+
+// PrepareRename checks that position is on a Deps key or on the name of a
+// component's class, and returns the range and text that would be renamed.
+func (s *State) PrepareRename(uri string, position lsp.Position) (*lsp.PrepareRenameResult, bool) {
+	if s.Index == nil {
+		return nil, false
+	}
+
+	document, root, err := s.SyntaxTree(uri)
+	if err != nil {
+		return nil, false
+	}
+
+	if entry, ok := DepsEntryAt(DepsEntries(s.Queries, root, document), position); ok {
+		if _, ok := s.resolveDepsKey(entry.Key, uri); !ok {
+			return nil, false
+		}
+
+		return &lsp.PrepareRenameResult{Range: entry.Range, Placeholder: entry.Key}, true
+	}
+
+	if _, ok := classNameAt(root, document, position); ok {
+		c, ok := s.Index.ComponentForURI(uri)
+		if !ok {
+			return nil, false
+		}
+
+		r, ok := FindClassDeclaration(s.Queries, root, document, c.ClassName)
+		if !ok {
+			return nil, false
+		}
+
+		return &lsp.PrepareRenameResult{Range: r, Placeholder: lastConstant(c.ClassName)}, true
+	}
+
+	return nil, false
+}
+
+// Rename builds the workspace edit that renames the component at position to
+// a new container key in the same namespace: its file is renamed, its class
+// constant is updated, and every Deps entry injecting it is rewritten.
+//
+// newName is a container key when renaming from a Deps entry, and a constant
+// when renaming from the class declaration.
+func (s *State) Rename(ctx context.Context, uri string, position lsp.Position, newName string) (*lsp.WorkspaceEdit, error) {
+	prepared, ok := s.PrepareRename(uri, position)
+	if !ok {
+		return nil, fmt.Errorf("nothing to rename at %d:%d in '%s'", position.Line, position.Character, uri)
+	}
+
+	target, ok := s.ComponentAt(uri, position)
+	if !ok {
+		return nil, fmt.Errorf("unable to resolve component at %d:%d in '%s'", position.Line, position.Character, uri)
+	}
+
+	var newKey string
+	if constantRe.MatchString(prepared.Placeholder) {
+		if !constantRe.MatchString(newName) {
+			return nil, fmt.Errorf("'%s' is not a valid constant name", newName)
+		}
+
+		segments := strings.Split(target.Key, ".")
+		segments[len(segments)-1] = Underscore(newName)
+		newKey = strings.Join(segments, ".")
+	} else {
+		newKey = newName
+		if prefix, rest, found := strings.Cut(newName, "."); found {
+			if slice, ok := s.Index.SliceForPrefix(target.Container, prefix); ok {
+				if slice != target.Container {
+					return nil, fmt.Errorf("moving '%s' to slice '%s' is not supported", target.QualifiedKey(), slice)
+				}
+				newKey = rest
+			}
+		}
+	}
+
+	for _, segment := range strings.Split(newKey, ".") {
+		if !keySegmentRe.MatchString(segment) {
+			return nil, fmt.Errorf("'%s' is not a valid container key", newKey)
+		}
+	}
+
+	// The file would move to another directory while its modules stay the
+	// same, so it would no longer autoload
+	if namespace(newKey) != namespace(target.Key) {
+		return nil, fmt.Errorf("moving '%s' to another namespace is not supported, only its last segment can be renamed", target.Key)
+	}
+
+	edit := &lsp.WorkspaceEdit{DocumentChanges: []any{}}
+	if newKey == target.Key {
+		return edit, nil
+	}
+
+	if _, exists := s.Index.Lookup(target.Container, newKey); exists {
+		return nil, fmt.Errorf("'%s' already exists in '%s'", newKey, target.Container)
+	}
+
+	newURI := strings.TrimSuffix(target.URI, strings.ReplaceAll(target.Key, ".", "/")+".rb") +
+		strings.ReplaceAll(newKey, ".", "/") + ".rb"
+
+	edits := map[string][]lsp.TextEdit{}
+	var order []string
+	addEdit := func(uri string, e lsp.TextEdit) {
+		if _, ok := edits[uri]; !ok {
+			order = append(order, uri)
+		}
+		edits[uri] = append(edits[uri], e)
+	}
+
+	if document, root, err := s.SyntaxTree(target.URI); err == nil {
+		if r, ok := FindClassDeclaration(s.Queries, root, document, target.ClassName); ok {
+			addEdit(target.URI, lsp.TextEdit{Range: r, NewText: Camelize(DefaultAlias(newKey))})
+		}
+	}
+
+	injections, err := s.FindInjections(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, injection := range injections {
+		entry := injection.Entry
+
+		key := newKey
+		if entry.Key != target.Key {
+			prefix, _, _ := strings.Cut(entry.Key, ".")
+			key = prefix + "." + newKey
+		}
+
+		if entry.Aliased || DefaultAlias(key) == entry.Alias {
+			addEdit(injection.URI, lsp.TextEdit{Range: entry.Range, NewText: key})
+			continue
+		}
+
+		// Keep the old name available inside the class by switching to the
+		// aliased form, so existing usages keep working.
+		addEdit(injection.URI, lsp.TextEdit{Range: entry.StringRange, NewText: fmt.Sprintf("%s: \"%s\"", entry.Alias, key)})
+	}
+
+	for _, uri := range order {
+		edit.DocumentChanges = append(edit.DocumentChanges, lsp.TextDocumentEdit{
+			TextDocument: lsp.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
+			},
+			Edits: edits[uri],
+		})
+	}
+	edit.DocumentChanges = append(edit.DocumentChanges, lsp.NewRenameFile(target.URI, newURI))
+
+	return edit, nil
+}
+
+// namespace is key without its last segment.
+func namespace(key string) string {
+	return strings.TrimSuffix(key, DefaultAlias(key))
+}
+
+func (s *State) TextDocumentPrepareRename(id lsp.ID, uri string, position lsp.Position) lsp.PrepareRenameResponse {
+	result, _ := s.PrepareRename(uri, position)
+
+	return lsp.PrepareRenameResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: result,
+	}
+}
+
+func (s *State) TextDocumentRename(ctx context.Context, id lsp.ID, uri string, position lsp.Position, newName string) (lsp.RenameResponse, error) {
+	edit, err := s.Rename(ctx, uri, position, newName)
+	if err != nil {
+		return lsp.RenameResponse{}, err
+	}
+
+	return lsp.RenameResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: edit,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"context"
+	"hanamilsp/lsp"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestPrepareRename(t *testing.T) {
+	is := is.New(t)
+
+	state, root := NewTestReferencesState(t)
+	operationURI := root + "/slices/domain/operations/create_goal.rb"
+	transactionURI := root + "/slices/domain/operations/transaction.rb"
+
+	result, ok := state.PrepareRename(operationURI, lsp.Position{Line: 4, Character: 15})
+	is.True(ok)
+	is.Equal(*result, lsp.PrepareRenameResult{Range: LineRange(4, 9, 31), Placeholder: "operations.transaction"})
+
+	result, ok = state.PrepareRename(transactionURI, lsp.Position{Line: 2, Character: 12})
+	is.True(ok)
+	is.Equal(*result, lsp.PrepareRenameResult{Range: LineRange(2, 10, 21), Placeholder: "Transaction"})
+
+	_, ok = state.PrepareRename(operationURI, lsp.Position{Line: 6, Character: 40})
+	is.True(!ok) // apply_visibility does not resolve
+}
+
+func TestRename(t *testing.T) {
+	is := is.New(t)
+
+	state, root := NewTestReferencesState(t)
+	operationURI := root + "/slices/domain/operations/create_goal.rb"
+	transactionURI := root + "/slices/domain/operations/transaction.rb"
+	collaborationURI := root + "/slices/collaborations/operations/queries/get_collaboration.rb"
+
+	expected := &lsp.WorkspaceEdit{
+		DocumentChanges: []any{
+			lsp.TextDocumentEdit{
+				TextDocument: lsp.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: transactionURI},
+				},
+				Edits: []lsp.TextEdit{{Range: LineRange(2, 10, 21), NewText: "UnitOfWork"}},
+			},
+			lsp.TextDocumentEdit{
+				TextDocument: lsp.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: collaborationURI},
+				},
+				Edits: []lsp.TextEdit{{Range: LineRange(4, 21, 52), NewText: `transaction: "domain.operations.unit_of_work"`}},
+			},
+			lsp.TextDocumentEdit{
+				TextDocument: lsp.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: operationURI},
+				},
+				Edits: []lsp.TextEdit{{Range: LineRange(4, 8, 32), NewText: `transaction: "operations.unit_of_work"`}},
+			},
+			lsp.NewRenameFile(transactionURI, root+"/slices/domain/operations/unit_of_work.rb"),
+		},
+	}
+
+	t.Run("from a Deps key", func(t *testing.T) {
+		edit, err := state.Rename(context.Background(), operationURI, lsp.Position{Line: 4, Character: 15}, "operations.unit_of_work")
+		is.NoErr(err)
+		is.Equal(edit, expected)
+	})
+
+	t.Run("from the class declaration", func(t *testing.T) {
+		edit, err := state.Rename(context.Background(), transactionURI, lsp.Position{Line: 2, Character: 12}, "UnitOfWork")
+		is.NoErr(err)
+		is.Equal(edit, expected)
+	})
+
+	t.Run("it rejects invalid keys", func(t *testing.T) {
+		_, err := state.Rename(context.Background(), operationURI, lsp.Position{Line: 4, Character: 15}, "operations.Nope")
+		is.True(err != nil)
+	})
+
+	t.Run("it rejects moving to another namespace", func(t *testing.T) {
+		_, err := state.Rename(context.Background(), operationURI, lsp.Position{Line: 4, Character: 15}, "operations.queries.transaction")
+		is.Equal(err.Error(), "moving 'operations.transaction' to another namespace is not supported, only its last segment can be renamed")
+	})
+
+	t.Run("it rejects moving between slices", func(t *testing.T) {
+		_, err := state.Rename(context.Background(), operationURI, lsp.Position{Line: 4, Character: 15}, "collaborations.operations.transaction")
+		is.True(err != nil)
+	})
+}
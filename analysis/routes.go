@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"regexp"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+var sliceRoutesRe = regexp.MustCompile(`^slices/(\w+)/config/routes\.rb$`)
+
+// routesContainer returns the container whose actions the routes file at uri
+// points to.
+func (s *State) routesContainer(uri string) (string, bool) {
+	rel, found := strings.CutPrefix(uri, s.Index.RootURI+"/")
+	if !found {
+		return "", false
+	}
+
+	if rel == "config/routes.rb" {
+		return AppContainer, true
+	}
+
+	if m := sliceRoutesRe.FindStringSubmatch(rel); m != nil {
+		return m[1], true
+	}
+
+	return "", false
+}
+
+// RouteDefinition resolves the `to: "goals.index"` string under position in a
+// routes file to the action it points to, taking enclosing
+// `slice :name, at: "/path" do` blocks into account.
+func (s *State) RouteDefinition(uri string, position lsp.Position) (lsp.Location, bool) {
+	if s.Index == nil {
+		return lsp.Location{}, false
+	}
+
+	container, ok := s.routesContainer(uri)
+	if !ok {
+		return lsp.Location{}, false
+	}
+
+	document, root, err := s.SyntaxTree(uri)
+	if err != nil {
+		return lsp.Location{}, false
+	}
+
+	n := nodeAt(root, document, position)
+	if n != nil && n.Type() == "string_content" {
+		n = n.Parent()
+	}
+	if n == nil || n.Type() != "string" {
+		return lsp.Location{}, false
+	}
+
+	pair := n.Parent()
+	if pair == nil || pair.Type() != "pair" || !pair.ChildByFieldName("value").Equal(n) ||
+		strings.TrimPrefix(pair.ChildByFieldName("key").Content(document), ":") != "to" {
+		return lsp.Location{}, false
+	}
+
+	if slice, ok := enclosingRouteSlice(pair, document); ok {
+		container = slice
+	}
+
+	key := "actions." + stringContent(n, document)
+	if c, ok := s.Index.Lookup(container, key); ok {
+		return lsp.Location{URI: c.URI}, true
+	}
+
+	destinationURI := s.Index.ContainerRootURI(container) + "/" + strings.ReplaceAll(key, ".", "/") + ".rb"
+	if _, err := StatURI(destinationURI); err != nil {
+		return lsp.Location{}, false
+	}
+
+	return lsp.Location{URI: destinationURI}, true
+}
+
+// enclosingRouteSlice finds the innermost `slice :name` block around n.
+func enclosingRouteSlice(n *sitter.Node, document []byte) (string, bool) {
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if p.Type() != "call" {
+			continue
+		}
+
+		method := p.ChildByFieldName("method")
+		args := p.ChildByFieldName("arguments")
+		if method == nil || args == nil || method.Content(document) != "slice" || args.NamedChildCount() == 0 {
+			continue
+		}
+
+		name := args.NamedChild(0)
+		switch name.Type() {
+		case "simple_symbol":
+			return strings.TrimPrefix(name.Content(document), ":"), true
+		case "string":
+			return stringContent(name, document), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const testRoutes = `module GoalsService
+  class Routes < Hanami::Routes
+    root to: "home.show"
+    get "/goals", to: "goals.index"
+
+    slice :domain, at: "/domain" do
+      post "/goals", to: "goals.create"
+    end
+  end
+end
+`
+
+const testSliceRoutes = `module Domain
+  class Routes < Hanami::Routes
+    get "/goals/:id", to: "goals.show"
+  end
+end
+`
+
+func TestRouteDefinition(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/routes.rb":                      testRoutes,
+		"app/actions/home/show.rb":              "",
+		"app/actions/goals/index.rb":            "",
+		"slices/domain/config/routes.rb":        testSliceRoutes,
+		"slices/domain/actions/goals/create.rb": "",
+		"slices/domain/actions/goals/show.rb":   "",
+	})
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	state.RootURI = lsp.DocumentURI(root)
+	state.IndexWorkspace()
+
+	testCases := []struct {
+		name     string
+		uri      string
+		position lsp.Position
+		expected string
+	}{
+		{
+			name:     "root route",
+			uri:      root + "/config/routes.rb",
+			position: lsp.Position{Line: 2, Character: 15},
+			expected: root + "/app/actions/home/show.rb",
+		},
+		{
+			name:     "app route",
+			uri:      root + "/config/routes.rb",
+			position: lsp.Position{Line: 3, Character: 25},
+			expected: root + "/app/actions/goals/index.rb",
+		},
+		{
+			name:     "route inside a slice block",
+			uri:      root + "/config/routes.rb",
+			position: lsp.Position{Line: 6, Character: 28},
+			expected: root + "/slices/domain/actions/goals/create.rb",
+		},
+		{
+			name:     "slice routes file",
+			uri:      root + "/slices/domain/config/routes.rb",
+			position: lsp.Position{Line: 2, Character: 30},
+			expected: root + "/slices/domain/actions/goals/show.rb",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			location, ok := state.RouteDefinition(tc.uri, tc.position)
+			is.True(ok)
+			is.Equal(location.URI, tc.expected)
+		})
+	}
+
+	t.Run("it ignores the path string", func(t *testing.T) {
+		_, ok := state.RouteDefinition(root+"/config/routes.rb", lsp.Position{Line: 3, Character: 10})
+		is.True(!ok)
+	})
+}
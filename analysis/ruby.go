@@ -0,0 +1,338 @@
+package analysis
+
+import (
+	"context"
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"os"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/ruby"
+)
+
+// Call is a method called on a local identifier, e.g. `transaction.call`.
+type Call struct {
+	Receiver string
+	Method   string
+	// Range from the start of the receiver to the end of the method name
+	Range lsp.Range
+	// Range of the receiver identifier only
+	ReceiverRange lsp.Range
+}
+
+func parseRuby(document []byte) *sitter.Tree {
+	return reparseRuby(nil, document)
+}
+
+// reparseRuby parses document reusing the unchanged parts of old, which must
+// have been updated with Tree.Edit to match document.
+func reparseRuby(old *sitter.Tree, document []byte) *sitter.Tree {
+	parser := sitter.NewParser()
+	parser.SetLanguage(ruby.GetLanguage())
+
+	tree, _ := parser.ParseCtx(
+		context.Background(),
+		old,
+		document,
+	)
+
+	return tree
+}
+
+// ParseCalls returns every call made on a local identifier in the document
+// parsed into root.
+func ParseCalls(lib *queries.Library, root *sitter.Node, document []byte) []Call {
+	q := lib.Get(queries.Calls)
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, root)
+
+	var calls []Call
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+
+		m = qc.FilterPredicates(m, document)
+
+		var receiver, method *sitter.Node
+		for _, c := range m.Captures {
+			switch q.CaptureNameForId(c.Index) {
+			case "receiver":
+				receiver = c.Node
+			case "method":
+				method = c.Node
+			}
+		}
+
+		if receiver == nil || method == nil {
+			continue
+		}
+
+		calls = append(calls, Call{
+			Receiver:      receiver.Content(document),
+			Method:        method.Content(document),
+			Range:         lsp.Range{Start: nodeRange(receiver, document).Start, End: nodeRange(method, document).End},
+			ReceiverRange: nodeRange(receiver, document),
+		})
+	}
+
+	return calls
+}
+
+// FindClassDeclaration returns the range of the name of the class or module
+// declaring className, matched on its last constant.
+func FindClassDeclaration(lib *queries.Library, root *sitter.Node, document []byte, className string) (lsp.Range, bool) {
+	_, name := findClassNode(lib, root, document, className)
+	if name == nil {
+		return lsp.Range{}, false
+	}
+
+	return nodeRange(name, document), true
+}
+
+func findClassNode(lib *queries.Library, root *sitter.Node, document []byte, className string) (*sitter.Node, *sitter.Node) {
+	want := lastConstant(className)
+
+	q := lib.Get(queries.Classes)
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, root)
+
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+
+		m = qc.FilterPredicates(m, document)
+		for _, c := range m.Captures {
+			if q.CaptureNameForId(c.Index) != "name" {
+				continue
+			}
+
+			name := c.Node
+			if name.Type() == "scope_resolution" {
+				name = name.ChildByFieldName("name")
+			}
+
+			if name != nil && name.Content(document) == want {
+				return c.Node.Parent(), name
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// ClassSummary describes the class declaring className: its leading comment
+// block and the parameter list of its `call` method.
+type ClassSummary struct {
+	Comment        string
+	CallParameters string
+	HasCall        bool
+}
+
+func SummarizeClass(lib *queries.Library, root *sitter.Node, document []byte, className string) (ClassSummary, bool) {
+	class, _ := findClassNode(lib, root, document, className)
+	if class == nil {
+		return ClassSummary{}, false
+	}
+
+	summary := ClassSummary{Comment: leadingComment(class, document)}
+
+	for i := 0; i < int(class.NamedChildCount()); i++ {
+		body := class.NamedChild(i)
+		if body.Type() != "body_statement" {
+			continue
+		}
+
+		for j := 0; j < int(body.NamedChildCount()); j++ {
+			method := body.NamedChild(j)
+			if method.Type() != "method" || method.ChildByFieldName("name").Content(document) != "call" {
+				continue
+			}
+
+			summary.HasCall = true
+			if params := method.ChildByFieldName("parameters"); params != nil {
+				summary.CallParameters = params.Content(document)
+			}
+		}
+	}
+
+	return summary, true
+}
+
+// leadingComment returns the block of comments directly above n, without the
+// leading '#'.
+func leadingComment(n *sitter.Node, document []byte) string {
+	sibling := n.PrevSibling()
+	if sibling == nil && n.Parent() != nil && n.Parent().Type() == "body_statement" {
+		sibling = n.Parent().PrevSibling()
+	}
+
+	var lines []string
+	row := n.StartPoint().Row
+	for sibling != nil && sibling.Type() == "comment" && sibling.EndPoint().Row+1 == row {
+		line := strings.TrimPrefix(sibling.Content(document), "#")
+		lines = append([]string{strings.TrimPrefix(line, " ")}, lines...)
+		row = sibling.StartPoint().Row
+		sibling = sibling.PrevSibling()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// classNameAt returns the name of the class or module whose name is under
+// position, if any.
+func classNameAt(root *sitter.Node, document []byte, position lsp.Position) (string, bool) {
+	n := nodeAt(root, document, position)
+	for n != nil && (n.Type() == "constant" || n.Type() == "scope_resolution") {
+		parent := n.Parent()
+		if parent == nil {
+			return "", false
+		}
+
+		if (parent.Type() == "class" || parent.Type() == "module") && parent.ChildByFieldName("name") != nil &&
+			parent.ChildByFieldName("name").Equal(n) {
+			return n.Content(document), true
+		}
+
+		n = parent
+	}
+
+	return "", false
+}
+
+// identifierAt returns the identifier under position, if any.
+func identifierAt(root *sitter.Node, document []byte, position lsp.Position) (string, bool) {
+	n := nodeAt(root, document, position)
+	if n == nil || n.Type() != "identifier" {
+		return "", false
+	}
+
+	return n.Content(document), true
+}
+
+// CallAt returns the `receiver.method` call under position. The call may
+// span several lines, e.g. when `.call` is chained on the line after its
+// receiver.
+func CallAt(root *sitter.Node, document []byte, position lsp.Position) (Call, bool) {
+	offset := uint32(OffsetForPosition(string(document), position))
+
+	for n := nodeAt(root, document, position); n != nil; n = n.Parent() {
+		if n.Type() != "call" {
+			continue
+		}
+
+		receiver := n.ChildByFieldName("receiver")
+		method := n.ChildByFieldName("method")
+		if receiver == nil || method == nil || receiver.Type() != "identifier" || method.Type() != "identifier" {
+			continue
+		}
+
+		if offset < receiver.StartByte() || offset > method.EndByte() {
+			continue
+		}
+
+		return Call{
+			Receiver:      receiver.Content(document),
+			Method:        method.Content(document),
+			Range:         lsp.Range{Start: nodeRange(receiver, document).Start, End: nodeRange(method, document).End},
+			ReceiverRange: nodeRange(receiver, document),
+		}, true
+	}
+
+	return Call{}, false
+}
+
+// SymbolAt returns the text of the most specific node under position.
+func SymbolAt(root *sitter.Node, document []byte, position lsp.Position) string {
+	n := nodeAt(root, document, position)
+	if n == nil || n.Equal(root) {
+		return ""
+	}
+
+	return n.Content(document)
+}
+
+// FindMethodDeclaration returns the position of the name of the first method
+// definition called methodName.
+func FindMethodDeclaration(lib *queries.Library, root *sitter.Node, document []byte, methodName string) (lsp.Position, bool) {
+	name := findMethodName(lib, root, document, methodName)
+	if name == nil {
+		return lsp.Position{}, false
+	}
+
+	return nodeRange(name, document).Start, true
+}
+
+// findMethodName returns the name node of the first method definition called
+// methodName, its parent is the whole definition.
+func findMethodName(lib *queries.Library, root *sitter.Node, document []byte, methodName string) *sitter.Node {
+	q := lib.Get(queries.Methods)
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, root)
+
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+
+		m = qc.FilterPredicates(m, document)
+		for _, c := range m.Captures {
+			if q.CaptureNameForId(c.Index) == "name" && c.Node.Content(document) == methodName {
+				return c.Node
+			}
+		}
+	}
+
+	return nil
+}
+
+// nodeAt returns the most specific named node at the byte offset of position.
+func nodeAt(root *sitter.Node, document []byte, position lsp.Position) *sitter.Node {
+	text := string(document)
+	p := PointForOffset(text, OffsetForPosition(text, position))
+	return root.NamedDescendantForPointRange(p, p)
+}
+
+// nodeRange returns the range of n in document, in UTF-16 code units.
+func nodeRange(n *sitter.Node, document []byte) lsp.Range {
+	return lsp.Range{
+		Start: positionForPoint(document, n.StartByte(), n.StartPoint()),
+		End:   positionForPoint(document, n.EndByte(), n.EndPoint()),
+	}
+}
+
+func lastConstant(className string) string {
+	return className[strings.LastIndex(className, ":")+1:]
+}
+
+// SyntaxTree returns the contents of uri and the root of its syntax tree. Open
+// documents use a copy of the tree kept up to date by OpenDocument and
+// UpdateDocument, anything else is read from disk and parsed.
+func (s *State) SyntaxTree(uri string) ([]byte, *sitter.Node, error) {
+	s.mu.RLock()
+	text, open := s.Documents[uri]
+	tree, parsed := s.Trees[uri]
+	if parsed {
+		tree = tree.Copy()
+	}
+	s.mu.RUnlock()
+
+	if open && parsed {
+		return []byte(text), tree.RootNode(), nil
+	}
+	if open {
+		return []byte(text), parseRuby([]byte(text)).RootNode(), nil
+	}
+
+	document, err := os.ReadFile(URIToPath(uri))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return document, parseRuby(document).RootNode(), nil
+}
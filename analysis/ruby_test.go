@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestCallAt(t *testing.T) {
+	is := is.New(t)
+
+	testCases := []struct {
+		name           string
+		document       string
+		position       lsp.Position
+		expectedSym    string
+		expectedMethod string
+	}{
+		{
+			name:           "basic",
+			document:       `goal_result = yield with_failure_prefix.call(prefix: "goal")`,
+			position:       lsp.Position{Line: 0, Character: 41},
+			expectedSym:    "with_failure_prefix",
+			expectedMethod: "call",
+		},
+		{
+			name:           "unterminated call",
+			document:       `updated_visibility = yield apply_visibility.call(`,
+			position:       lsp.Position{Line: 0, Character: 42},
+			expectedSym:    "apply_visibility",
+			expectedMethod: "call",
+		},
+		{
+			name:           "multiple calls on the same line",
+			document:       `metadata = metadata_repo.find(goal_repo.find(id).metadata_id)`,
+			position:       lsp.Position{Line: 0, Character: 36},
+			expectedSym:    "goal_repo",
+			expectedMethod: "find",
+		},
+		{
+			name:           "call split over several lines",
+			document:       "def call\n  transaction\n    .call(\n      goal\n    )\nend\n",
+			position:       lsp.Position{Line: 2, Character: 6},
+			expectedSym:    "transaction",
+			expectedMethod: "call",
+		},
+		{
+			name:           "arguments on a later line",
+			document:       "result = create_key_result.call(\n  goal: goal,\n)\n",
+			position:       lsp.Position{Line: 0, Character: 12},
+			expectedSym:    "create_key_result",
+			expectedMethod: "call",
+		},
+		{
+			name:     "sym and method not found",
+			document: `"operations.with_failure_prefix"`,
+			position: lsp.Position{Line: 0, Character: 18},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			document := []byte(tc.document)
+
+			call, _ := CallAt(parseRuby(document).RootNode(), document, tc.position)
+			is.Equal(call.Receiver, tc.expectedSym)
+			is.Equal(call.Method, tc.expectedMethod)
+		})
+	}
+}
+
+func TestSymbolAt(t *testing.T) {
+	is := is.New(t)
+
+	document := []byte("goal, key_results = transaction.call do\nend\n")
+	root := parseRuby(document).RootNode()
+
+	is.Equal(SymbolAt(root, document, lsp.Position{Line: 0, Character: 23}), "transaction")
+	is.Equal(SymbolAt(root, document, lsp.Position{Line: 0, Character: 2}), "goal")
+}
+
+func TestFindMethodDeclaration(t *testing.T) {
+	is := is.New(t)
+
+	document := []byte(testOperation)
+
+	pos, ok := FindMethodDeclaration(queries.Default, parseRuby(document).RootNode(), document, "call")
+	is.True(ok)
+	is.Equal(pos, lsp.Position{Line: 10, Character: 10})
+
+	_, ok = FindMethodDeclaration(queries.Default, parseRuby(document).RootNode(), document, "missing")
+	is.True(!ok)
+}
@@ -0,0 +1,334 @@
+package analysis
+
+import (
+	"errors"
+	"hanamilsp/queries"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigFile is read from the workspace root, if present
+const ProjectConfigFile = ".hanamilsp.yml"
+
+// SliceImport is a single `import from: :other, as: :alias, keys: [...]`
+// declaration in a slice class.
+type SliceImport struct {
+	// Name of the slice providing the keys
+	From string
+	// Prefix the imported keys are available under, defaults to From
+	As string
+	// Imported keys, nil imports everything From exports
+	Keys []string
+}
+
+type Slice struct {
+	Name    string
+	Imports []SliceImport
+	// Keys other slices may import, nil exports everything
+	Exports []string
+}
+
+// SliceOptions override what is discovered from the workspace.
+type SliceOptions struct {
+	// Map of key prefix to slice name, e.g. {"dom": "domain"}
+	Aliases map[string]string `json:"aliases" yaml:"aliases"`
+}
+
+type projectConfig struct {
+	Slices SliceOptions `yaml:"slices"`
+}
+
+// DiscoverSlices finds every slice in the workspace, from directories under
+// slices/, slice classes in config/slices/*.rb or slices/*/config/slice.rb and
+// `register_slice` blocks in config/app.rb, along with their import and export
+// declarations.
+func DiscoverSlices(lib *queries.Library, root string) map[string]*Slice {
+	slices := map[string]*Slice{}
+
+	entries, _ := os.ReadDir(filepath.Join(root, "slices"))
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			slices[e.Name()] = &Slice{Name: e.Name()}
+		}
+	}
+
+	configs, _ := filepath.Glob(filepath.Join(root, "config", "slices", "*.rb"))
+	for _, path := range configs {
+		name := strings.TrimSuffix(filepath.Base(path), ".rb")
+		if slices[name] == nil {
+			slices[name] = &Slice{Name: name}
+		}
+	}
+
+	for name, slice := range slices {
+		for _, path := range []string{
+			filepath.Join(root, "config", "slices", name+".rb"),
+			filepath.Join(root, "slices", name, "config", "slice.rb"),
+		} {
+			document, err := os.ReadFile(path)
+			if err == nil {
+				parseSliceConfig(lib, slice, document)
+			}
+		}
+	}
+
+	if document, err := os.ReadFile(filepath.Join(root, "config", "app.rb")); err == nil {
+		parseAppConfig(lib, slices, document)
+	}
+
+	return slices
+}
+
+func parseSliceConfig(lib *queries.Library, slice *Slice, document []byte) {
+	parseSliceDeclarations(lib, document, func(*sitter.Node) *Slice { return slice })
+}
+
+// parseAppConfig reads the declarations made inside `register_slice :name do`
+// blocks in config/app.rb, adding the slices they name if needed.
+func parseAppConfig(lib *queries.Library, slices map[string]*Slice, document []byte) {
+	parseSliceDeclarations(lib, document, func(declaration *sitter.Node) *Slice {
+		for n := declaration.Parent(); n != nil; n = n.Parent() {
+			if n.Type() != "call" || n.ChildByFieldName("block") == nil {
+				continue
+			}
+
+			method := n.ChildByFieldName("method")
+			args := n.ChildByFieldName("arguments")
+			if method == nil || method.Content(document) != "register_slice" || args == nil || args.NamedChildCount() == 0 {
+				continue
+			}
+
+			name := symbolOrString(args.NamedChild(0), document)
+			if name == "" {
+				return nil
+			}
+			if slices[name] == nil {
+				slices[name] = &Slice{Name: name}
+			}
+			return slices[name]
+		}
+
+		return nil
+	})
+}
+
+// parseSliceDeclarations adds each import and export declaration in document
+// to the slice returned by sliceFor for the declaring call, skipping those it
+// returns nil for.
+func parseSliceDeclarations(lib *queries.Library, document []byte, sliceFor func(declaration *sitter.Node) *Slice) {
+	q := lib.Get(queries.SliceConfig)
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, parseRuby(document).RootNode())
+
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+
+		m = qc.FilterPredicates(m, document)
+
+		var method string
+		var args *sitter.Node
+		for _, c := range m.Captures {
+			switch q.CaptureNameForId(c.Index) {
+			case "method":
+				method = c.Node.Content(document)
+			case "args":
+				args = c.Node
+			}
+		}
+
+		if args == nil {
+			continue
+		}
+
+		slice := sliceFor(args.Parent())
+		if slice == nil {
+			continue
+		}
+
+		switch method {
+		case "export":
+			if args.NamedChildCount() > 0 {
+				slice.Exports = append(slice.Exports, stringList(args.NamedChild(0), document)...)
+			}
+		case "import":
+			var imp SliceImport
+			for i := 0; i < int(args.NamedChildCount()); i++ {
+				pair := args.NamedChild(i)
+				if pair.Type() != "pair" {
+					continue
+				}
+
+				value := pair.ChildByFieldName("value")
+				switch strings.TrimPrefix(pair.ChildByFieldName("key").Content(document), ":") {
+				case "from":
+					imp.From = symbolOrString(value, document)
+				case "as":
+					imp.As = symbolOrString(value, document)
+				case "keys":
+					imp.Keys = stringList(value, document)
+				}
+			}
+
+			if imp.From == "" {
+				continue
+			}
+			if imp.As == "" {
+				imp.As = imp.From
+			}
+			slice.Imports = append(slice.Imports, imp)
+		}
+	}
+}
+
+func stringList(n *sitter.Node, document []byte) []string {
+	list := []string{}
+	if n.Type() != "array" {
+		return list
+	}
+
+	for i := 0; i < int(n.NamedChildCount()); i++ {
+		if v := symbolOrString(n.NamedChild(i), document); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+func symbolOrString(n *sitter.Node, document []byte) string {
+	switch n.Type() {
+	case "simple_symbol":
+		return strings.TrimPrefix(n.Content(document), ":")
+	case "string":
+		return stringContent(n, document)
+	}
+
+	return ""
+}
+
+// LoadProjectSliceOptions reads the slice overrides from .hanamilsp.yml in
+// the workspace root.
+func LoadProjectSliceOptions(root string) (SliceOptions, error) {
+	b, err := os.ReadFile(filepath.Join(root, ProjectConfigFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return SliceOptions{}, nil
+	}
+	if err != nil {
+		return SliceOptions{}, err
+	}
+
+	var config projectConfig
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return SliceOptions{}, err
+	}
+
+	return config.Slices, nil
+}
+
+// Merge returns o with the values of other taking precedence.
+func (o SliceOptions) Merge(other SliceOptions) SliceOptions {
+	merged := SliceOptions{Aliases: map[string]string{}}
+	for k, v := range o.Aliases {
+		merged.Aliases[k] = v
+	}
+	for k, v := range other.Aliases {
+		merged.Aliases[k] = v
+	}
+
+	return merged
+}
+
+// SliceForPrefix returns the slice that a key prefix refers to when used from
+// the container named from: configured aliases first, then the importing
+// slice's `import ... as:` declarations, then plain slice names.
+func (idx *Index) SliceForPrefix(from string, prefix string) (string, bool) {
+	if slice, ok := idx.Aliases[prefix]; ok {
+		return slice, true
+	}
+
+	if slice, ok := idx.Slices[from]; ok {
+		for _, imp := range slice.Imports {
+			if imp.As == prefix {
+				return imp.From, true
+			}
+		}
+	}
+
+	if _, ok := idx.Slices[prefix]; ok {
+		return prefix, true
+	}
+
+	return "", false
+}
+
+// SlicePrefixes returns the key prefixes declared for the container named
+// from, by its `import ... as:` declarations and the configured aliases,
+// mapped to the slice they refer to.
+func (idx *Index) SlicePrefixes(from string) map[string]string {
+	prefixes := map[string]string{}
+	if slice, ok := idx.Slices[from]; ok {
+		for _, imp := range slice.Imports {
+			prefixes[imp.As] = imp.From
+		}
+	}
+
+	for prefix, slice := range idx.Aliases {
+		prefixes[prefix] = slice
+	}
+
+	return prefixes
+}
+
+// ImportedKeys returns the keys of the slice behind prefix that the container
+// named from may inject without crossing a slice boundary, narrowed to the
+// keys listed by the import declaring prefix, if it lists any.
+func (idx *Index) ImportedKeys(from string, prefix string) []string {
+	slice, ok := idx.SliceForPrefix(from, prefix)
+	if !ok {
+		return nil
+	}
+
+	var listed []string
+	if importer, ok := idx.Slices[from]; ok {
+		for _, imp := range importer.Imports {
+			if imp.As == prefix {
+				listed = imp.Keys
+				break
+			}
+		}
+	}
+
+	var keys []string
+	for _, key := range idx.Keys(slice) {
+		c, _ := idx.Lookup(slice, key)
+		if _, violation := idx.BoundaryViolation(from, c); violation {
+			continue
+		}
+		if listed != nil && !slices.Contains(listed, key) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// SortedPrefixes returns the keys of prefixes in order.
+func SortedPrefixes(prefixes map[string]string) []string {
+	keys := make([]string, 0, len(prefixes))
+	for k := range prefixes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
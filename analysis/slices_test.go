@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"encoding/json"
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const testSliceConfig = `module Domain
+  class Slice < Hanami::Slice
+    import keys: ["operations.queries.get_collaboration"], from: :collaborations, as: :collab
+    import from: :search
+
+    export ["operations.transaction", "repositories.goal_repo"]
+  end
+end
+`
+
+func TestDiscoverSlices(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/app.rb":                           "module GoalsService\n  class App < Hanami::App\n    register_slice :admin do\n      import from: :domain\n    end\n  end\nend\n",
+		"config/slices/domain.rb":                 testSliceConfig,
+		"slices/domain/operations/transaction.rb": "",
+		"slices/collaborations/operations/queries/get_collaboration.rb": "",
+		"slices/search/config/slice.rb":                                 "module Search\n  class Slice < Hanami::Slice\n    export [\"queries.find\"]\n  end\nend\n",
+	})
+
+	slices := DiscoverSlices(queries.Default, root)
+
+	is.Equal(len(slices), 4)
+	is.Equal(*slices["domain"], Slice{
+		Name: "domain",
+		Imports: []SliceImport{
+			{From: "collaborations", As: "collab", Keys: []string{"operations.queries.get_collaboration"}},
+			{From: "search", As: "search"},
+		},
+		Exports: []string{"operations.transaction", "repositories.goal_repo"},
+	})
+	is.Equal(slices["search"].Exports, []string{"queries.find"})
+	is.Equal(slices["collaborations"].Exports, nil)
+	is.Equal(slices["admin"].Imports, []SliceImport{{From: "domain", As: "domain"}})
+}
+
+func TestSliceAliases(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/slices/domain.rb":                                       testSliceConfig,
+		".hanamilsp.yml":                                                "slices:\n  aliases:\n    core: domain\n    shared: collaborations\n",
+		"slices/domain/operations/transaction.rb":                       "",
+		"slices/collaborations/operations/queries/get_collaboration.rb": "",
+	})
+	uri := root + "/slices/domain/operations/transaction.rb"
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	state.RootURI = lsp.DocumentURI(root)
+
+	config, err := ParseConfig(json.RawMessage(`{"slices": {"aliases": {"shared": "domain"}}}`))
+	is.NoErr(err)
+	state.Config = config
+	state.IndexWorkspace()
+
+	testCases := []struct {
+		key       string
+		container string
+	}{
+		{key: "collab.operations.queries.get_collaboration", container: "collaborations"},
+		{key: "collaborations.operations.queries.get_collaboration", container: "collaborations"},
+		{key: "core.operations.transaction", container: "domain"},
+		{key: "shared.operations.transaction", container: "domain"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			c, ok := state.resolveDepsKey(tc.key, uri)
+			is.True(ok)
+			is.Equal(c.Container, tc.container)
+		})
+	}
+
+	t.Run("it falls back to path inference for aliased keys", func(t *testing.T) {
+		destinationURI, err := state.GetDefinitionURI("collab.operations.missing", uri, root)
+		is.NoErr(err)
+		is.Equal(destinationURI, root+"/slices/collaborations/operations/missing.rb")
+	})
+}
@@ -1,16 +1,48 @@
 package analysis
 
 import (
+	"errors"
+	"fmt"
 	"hanamilsp/lsp"
+	"hanamilsp/queries"
 	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	sitter "github.com/smacker/go-tree-sitter"
 )
 
 type State struct {
+	// Guards Documents, Versions, Trees and changed, which are updated by
+	// document notifications while requests read them concurrently
+	mu sync.RWMutex
 	// Map of file names to contents
 	Documents map[string]string
-	RootURI   lsp.DocumentURI
-	Logger    *log.Logger
+	// Map of file names to the version last received from the client
+	Versions map[string]int
+	// Map of file names to their syntax tree, kept in sync with Documents.
+	// Trees are not safe for concurrent use, so the stored ones are only
+	// ever copied
+	Trees map[string]*sitter.Tree
+	// Map of file names to when they last changed on disk or were closed,
+	// until then the index's table holds what they contained
+	changed map[string]time.Time
+	RootURI lsp.DocumentURI
+	Logger  *log.Logger
+	// Container keys of the workspace, built on initialize
+	Index *Index
+	// Settings sent by the editor, replaced together with Index by SetConfig
+	Config Config
+	// Compiled tree-sitter queries, including the workspace's overrides
+	Queries *queries.Library
+	// Indexes shared with other connections, nil when serving a single editor
+	Workspaces *Workspaces
 }
 
 func NewState(
@@ -18,51 +50,310 @@ func NewState(
 ) *State {
 	return &State{
 		Documents: map[string]string{},
+		Versions:  map[string]int{},
+		Trees:     map[string]*sitter.Tree{},
+		changed:   map[string]time.Time{},
 		Logger:    logger,
+		Queries:   queries.Default,
+	}
+}
+
+// IndexWorkspace builds the container key index for RootURI, or reuses the
+// one built for another connection when Workspaces is set.
+func (s *State) IndexWorkspace() {
+	build := s.indexBuilder(s.Config.Index)
+	if s.Workspaces != nil {
+		s.SetIndex(s.Workspaces.load(workspaceKey(s.RootURI, s.Config.Index), build))
+	} else {
+		s.SetIndex(build())
+	}
+}
+
+// RebuildIndex indexes RootURI again with config after files changed on disk
+// at changedAt. The result is only used once passed to SetIndex.
+func (s *State) RebuildIndex(changedAt time.Time, config IndexConfig) (*Index, *queries.Library) {
+	build := s.indexBuilder(config)
+	if s.Workspaces != nil {
+		return s.Workspaces.reload(workspaceKey(s.RootURI, config), changedAt, build)
+	}
+
+	return build()
+}
+
+// SetIndex replaces Index and Queries, and starts parsing the workspace for
+// the index's table in the background. It must not run while requests read
+// them.
+func (s *State) SetIndex(idx *Index, lib *queries.Library) {
+	s.UseIndex(idx, lib)
+
+	// Parse the workspace's classes now rather than on the first
+	// workspace/symbol request
+	go s.Index.symbols.load(s.Index)
+}
+
+// UseIndex replaces Index and Queries like SetIndex, leaving the index's table
+// to be built on first use, e.g. for a single command line run.
+func (s *State) UseIndex(idx *Index, lib *queries.Library) {
+	projectOptions, err := LoadProjectSliceOptions(URIToPath(idx.RootURI))
+	if err != nil {
+		s.Logger.Printf("error: unable to read '%s', err: %s", ProjectConfigFile, err)
+	}
+
+	// Aliases come from this connection's initializationOptions, so they are
+	// kept on a copy rather than on the shared index
+	connectionIndex := *idx
+	connectionIndex.Aliases = projectOptions.Merge(s.Config.Slices).Aliases
+	s.Index = &connectionIndex
+	s.Queries = lib
+}
+
+// SetConfig replaces Config and applies new slice aliases to Index. It
+// reports whether the index exclusions changed, in which case the workspace
+// must be indexed again. Like SetIndex, it must not run while requests read
+// the index.
+func (s *State) SetConfig(config Config) bool {
+	previous := s.Config
+	s.Config = config
+
+	if s.Index == nil {
+		return false
+	}
+	if !slices.Equal(previous.Index.Exclude, config.Index.Exclude) {
+		return true
+	}
+
+	s.SetIndex(s.Index, s.Queries)
+	return false
+}
+
+// workspaceKey identifies the index of a workspace in Workspaces, which
+// depends on the root and on what is excluded from it.
+func workspaceKey(rootURI lsp.DocumentURI, config IndexConfig) string {
+	return strings.Join(append([]string{string(rootURI)}, config.Exclude...), "\n")
+}
+
+func (s *State) indexBuilder(config IndexConfig) func() (*Index, *queries.Library) {
+	return func() (*Index, *queries.Library) {
+		lib, err := queries.Load(filepath.Join(URIToPath(string(s.RootURI)), queries.OverrideDir))
+		if err != nil {
+			s.Logger.Printf("error: unable to load query overrides, err: %s", err)
+		}
+
+		idx, err := BuildIndex(lib, string(s.RootURI), config)
+		if err != nil {
+			s.Logger.Printf("error: unable to fully index workspace '%s', err: %s", s.RootURI, err)
+		}
+
+		s.Logger.Printf("indexed %d ruby files in workspace '%s'", len(idx.Files), s.RootURI)
+		return idx, lib
 	}
 }
 
-func getDiagnosticsForFile(text string) []lsp.Diagnostic {
+func (s *State) GetDefinitionURI(currentLine string, currentURI string, rootURI string) (string, error) {
+	trimmedLine := strings.Trim(currentLine, " \",")
+
+	destURIExtension := strings.Replace(trimmedLine, ".", "/", -1) + ".rb"
+
+	if s.Index != nil {
+		if container, ok := s.Index.ContainerForURI(currentURI); ok {
+			if c, ok := s.Index.Resolve(trimmedLine, container); ok {
+				return c.URI, nil
+			}
+
+			// Unregistered keys still point at the file they would be
+			// loaded from, in the aliased slice or the current container.
+			if prefix, rest, found := strings.Cut(trimmedLine, "."); found {
+				if slice, ok := s.Index.SliceForPrefix(container, prefix); ok {
+					return s.Index.ContainerRootURI(slice) + "/" + strings.Replace(rest, ".", "/", -1) + ".rb", nil
+				}
+			}
+
+			return s.Index.ContainerRootURI(container) + "/" + destURIExtension, nil
+		}
+	}
+
+	re := regexp.MustCompile(regexp.QuoteMeta(rootURI) + `/slices/(\w*)/`)
+	matches := re.FindStringSubmatch(currentURI)
+	if len(matches) < 2 {
+		return "", errors.New("unable to infer current slice name")
+	}
+
+	return rootURI + "/slices/" + matches[1] + "/" + destURIExtension, nil
+}
+
+// getDiagnosticsForFile flags every Deps key that does not resolve to a file
+// in the workspace, or that crosses a slice boundary without being imported.
+func (s *State) getDiagnosticsForFile(uri string, document []byte, root *sitter.Node) []lsp.Diagnostic {
 	diagnostics := []lsp.Diagnostic{}
-	for row, line := range strings.Split(text, "\n") {
-		if strings.Contains(line, "VS Code") {
-			idx := strings.Index(line, "VS Code")
+	unresolved := s.Config.DiagnosticEnabled(DiagnosticUnresolvedKey)
+	boundaries := s.Config.DiagnosticEnabled(DiagnosticSliceBoundary)
+	if !unresolved && !boundaries {
+		return diagnostics
+	}
+
+	for _, entry := range DepsEntries(s.Queries, root, document) {
+		if boundaries {
+			if d, ok := s.boundaryDiagnostic(uri, entry); ok {
+				diagnostics = append(diagnostics, d)
+				continue
+			}
+		}
+
+		if !unresolved {
+			continue
+		}
+
+		destinationURI, err := s.GetDefinitionURI(entry.Key, uri, string(s.RootURI))
+		if err != nil {
 			diagnostics = append(diagnostics, lsp.Diagnostic{
-				Range:    LineRange(row, idx, idx+len("VS Code")),
+				Range:    entry.Range,
 				Severity: 1,
-				Source:   "Common Sense",
-				Message:  "Please make sure we use good language in this video",
+				Code:     DiagnosticUnresolvedKey,
+				Source:   "hanamilsp",
+				Message:  fmt.Sprintf("unable to resolve '%s', %s", entry.Key, err),
 			})
+			continue
 		}
 
-		if strings.Contains(line, "Neovim") {
-			idx := strings.Index(line, "Neovim")
+		if _, err := StatURI(destinationURI); err != nil {
 			diagnostics = append(diagnostics, lsp.Diagnostic{
-				Range:    LineRange(row, idx, idx+len("Neovim")),
-				Severity: 2,
-				Source:   "Common Sense",
-				Message:  "Great choice :)",
+				Range:    entry.Range,
+				Severity: 1,
+				Code:     DiagnosticUnresolvedKey,
+				Source:   "hanamilsp",
+				Message:  fmt.Sprintf("unable to resolve '%s', %s does not exist", entry.Key, URIToPath(destinationURI)),
 			})
-
 		}
 	}
 
 	return diagnostics
 }
 
-func (s *State) OpenDocument(uri, text string) []lsp.Diagnostic {
+// OpenDocument keeps the contents and syntax tree of uri until it is closed.
+func (s *State) OpenDocument(uri string, version int, text string) {
+	tree := parseRuby([]byte(text))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.Documents[uri] = text
+	s.Versions[uri] = version
+	s.Trees[uri] = tree
+}
+
+// Diagnostics returns the diagnostics of the open document at uri. They read
+// the index, unlike the document updates.
+func (s *State) Diagnostics(uri string) []lsp.Diagnostic {
+	document, root, err := s.SyntaxTree(uri)
+	if err != nil {
+		return []lsp.Diagnostic{}
+	}
+
+	return s.getDiagnosticsForFile(uri, document, root)
+}
+
+// OpenDocuments returns the sorted uris of every open document.
+func (s *State) OpenDocuments() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	uris := make([]string, 0, len(s.Documents))
+	for uri := range s.Documents {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
 
-	return getDiagnosticsForFile(text)
+	return uris
 }
 
-func (s *State) UpdateDocument(uri, text string) []lsp.Diagnostic {
+// Version returns the version of the open document at uri.
+func (s *State) Version(uri string) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	version, ok := s.Versions[uri]
+	return version, ok
+}
+
+// Document returns the contents of the open document at uri.
+func (s *State) Document(uri string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	text, ok := s.Documents[uri]
+	return text, ok
+}
+
+// UpdateDocument applies content changes in order. Changes with a range are
+// applied to the stored text and syntax tree, which is then re-parsed
+// incrementally; changes without one replace the whole document.
+func (s *State) UpdateDocument(uri string, version int, changes []lsp.TextDocumentContentChangeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.Versions[uri]; ok && version <= current {
+		s.Logger.Printf("warning: got version %d of '%s' after version %d", version, uri, current)
+	}
+
+	text := s.Documents[uri]
+	tree := s.Trees[uri]
+	if tree != nil {
+		tree = tree.Copy()
+	}
+	for _, change := range changes {
+		if change.Range == nil {
+			text = change.Text
+			tree = nil
+			continue
+		}
+
+		start := OffsetForPosition(text, change.Range.Start)
+		end := max(OffsetForPosition(text, change.Range.End), start)
+		newText := text[:start] + change.Text + text[end:]
+
+		if tree != nil {
+			newEnd := start + len(change.Text)
+			tree.Edit(sitter.EditInput{
+				StartIndex:  uint32(start),
+				OldEndIndex: uint32(end),
+				NewEndIndex: uint32(newEnd),
+				StartPoint:  PointForOffset(text, start),
+				OldEndPoint: PointForOffset(text, end),
+				NewEndPoint: PointForOffset(newText, newEnd),
+			})
+		}
+
+		text = newText
+	}
+
 	s.Documents[uri] = text
+	s.Versions[uri] = version
+	s.Trees[uri] = reparseRuby(tree, []byte(text))
+}
+
+// CloseDocument forgets the contents and syntax tree of uri, later lookups
+// read it from disk.
+func (s *State) CloseDocument(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.Documents, uri)
+	delete(s.Versions, uri)
+	delete(s.Trees, uri)
+	s.changed[uri] = time.Now()
+}
+
+// FileChanged records that the file at uri changed on disk, so that it is
+// read again rather than taken from the index's table until the table is
+// built again.
+func (s *State) FileChanged(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return getDiagnosticsForFile(text)
+	s.changed[uri] = time.Now()
 }
 
-// func (s *State) TextDocumentCodeAction(id int, uri string) lsp.TextDocumentCodeActionResponse {
+// func (s *State) TextDocumentCodeAction(id lsp.ID, uri string) lsp.TextDocumentCodeActionResponse {
 // 	text := s.Documents[uri]
 //
 // 	actions := []lsp.CodeAction{}
@@ -108,27 +399,73 @@ func (s *State) UpdateDocument(uri, text string) []lsp.Diagnostic {
 // 	return response
 // }
 
-// func (s *State) TextDocumentCompletion(id int, uri string) lsp.CompletionResponse {
-//
-// 	// Ask your static analysis tools to figure out good completions
-// 	items := []lsp.CompletionItem{
-// 		{
-// 			Label:         "Neovim (BTW)",
-// 			Detail:        "Very cool editor",
-// 			Documentation: "Fun to watch in videos. Don't forget to like & subscribe to streamers using it :)",
-// 		},
-// 	}
-//
-// 	response := lsp.CompletionResponse{
-// 		Response: lsp.Response{
-// 			RPC: "2.0",
-// 			ID:  &id,
-// 		},
-// 		Result: items,
-// 	}
-//
-// 	return response
-// }
+func (s *State) TextDocumentCompletion(id lsp.ID, uri string, position lsp.Position) lsp.CompletionResponse {
+	items := []lsp.CompletionItem{}
+
+	response := lsp.CompletionResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: items,
+	}
+
+	if s.Index == nil {
+		return response
+	}
+
+	document, root, err := s.SyntaxTree(uri)
+	if err != nil {
+		return response
+	}
+
+	entry, ok := DepsEntryAt(DepsEntries(s.Queries, root, document), position)
+	if !ok {
+		return response
+	}
+
+	container, ok := s.Index.ContainerForURI(uri)
+	if !ok {
+		return response
+	}
+
+	newItem := func(label string, kind int, detail string) lsp.CompletionItem {
+		return lsp.CompletionItem{
+			Label:  label,
+			Kind:   kind,
+			Detail: detail,
+			TextEdit: &lsp.TextEdit{
+				Range:   entry.Range,
+				NewText: label,
+			},
+		}
+	}
+
+	for _, key := range s.Index.Keys(container) {
+		c, _ := s.Index.Lookup(container, key)
+		items = append(items, newItem(key, lsp.CompletionItemKindClass, URIToPath(c.URI)))
+	}
+
+	if container != AppContainer && container != LibContainer {
+		prefixes := s.Index.SlicePrefixes(container)
+		for _, prefix := range SortedPrefixes(prefixes) {
+			slice := prefixes[prefix]
+
+			items = append(items, newItem(prefix+".", lsp.CompletionItemKindModule, "slices/"+slice))
+			for _, key := range s.Index.ImportedKeys(container, prefix) {
+				c, _ := s.Index.Lookup(slice, key)
+				items = append(items, newItem(prefix+"."+key, lsp.CompletionItemKindClass, URIToPath(c.URI)))
+			}
+		}
+	}
+
+	response.Result = items
+	return response
+}
+
+func StatURI(input string) (os.FileInfo, error) {
+	return os.Stat(URIToPath(input))
+}
 
 func LineRange(line, start, end int) lsp.Range {
 	return lsp.Range{
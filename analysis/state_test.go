@@ -35,3 +35,155 @@ func TestRegexp(t *testing.T) {
 	re := regexp.MustCompile(rootURI + `/slices/(\w*)/`)
 	t.Log(re.FindStringSubmatch(currentURI))
 }
+
+func TestTextDocumentCompletion(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/slices/domain.rb":                                         "module Domain\n  class Slice < Hanami::Slice\n    import keys: [\"operations.queries.get_collaboration\", \"operations.queries.authorize\"], from: :collaborations, as: :collab\n  end\nend\n",
+		"config/slices/collaborations.rb":                                 "module Collaborations\n  class Slice < Hanami::Slice\n    export [\"operations.queries.get_collaboration\", \"operations.queries.list_collaborations\"]\n  end\nend\n",
+		"slices/domain/operations/create_goal.rb":                         testOperation,
+		"slices/domain/operations/transaction.rb":                         "",
+		"slices/collaborations/operations/queries/get_collaboration.rb":   "",
+		"slices/collaborations/operations/queries/list_collaborations.rb": "",
+		"slices/collaborations/operations/queries/authorize.rb":           "",
+		"slices/billing/operations/charge.rb":                             "",
+	})
+	uri := root + "/slices/domain/operations/create_goal.rb"
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	state.RootURI = lsp.DocumentURI(root)
+	state.IndexWorkspace()
+	state.OpenDocument(uri, 1, testOperation)
+
+	t.Run("it completes keys inside a Deps string", func(t *testing.T) {
+		resp := state.TextDocumentCompletion(lsp.IntID(1), uri, lsp.Position{Line: 7, Character: 9})
+
+		var labels []string
+		for _, item := range resp.Result {
+			labels = append(labels, item.Label)
+		}
+
+		is.Equal(labels, []string{
+			"operations.create_goal",
+			"operations.transaction",
+			"collab.",
+			"collab.operations.queries.get_collaboration",
+		})
+		is.Equal(resp.Result[1].Detail, root+"/slices/domain/operations/transaction.rb")
+		is.Equal(resp.Result[1].TextEdit.Range, LineRange(7, 9, 9))
+	})
+
+	t.Run("it only offers slices and keys that are imported and exported", func(t *testing.T) {
+		aliases := state.Index.Aliases
+		state.Index.Aliases = map[string]string{"collaborations": "collaborations"}
+		defer func() { state.Index.Aliases = aliases }()
+
+		resp := state.TextDocumentCompletion(lsp.IntID(1), uri, lsp.Position{Line: 7, Character: 9})
+
+		var labels []string
+		for _, item := range resp.Result {
+			labels = append(labels, item.Label)
+		}
+
+		is.Equal(labels[2:], []string{
+			"collab.",
+			"collab.operations.queries.get_collaboration",
+			"collaborations.",
+			"collaborations.operations.queries.get_collaboration",
+		})
+	})
+
+	t.Run("it does not complete outside of a Deps string", func(t *testing.T) {
+		resp := state.TextDocumentCompletion(lsp.IntID(1), uri, lsp.Position{Line: 11, Character: 10})
+		is.Equal(len(resp.Result), 0)
+	})
+}
+
+func TestGetDiagnosticsForFile(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/slices/domain.rb":                                       "module Domain\n  class Slice < Hanami::Slice\n    import from: :collaborations\n  end\nend\n",
+		"slices/domain/operations/create_goal.rb":                       testOperation,
+		"slices/domain/operations/transaction.rb":                       "",
+		"slices/collaborations/operations/queries/get_collaboration.rb": "",
+	})
+	uri := root + "/slices/domain/operations/create_goal.rb"
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	state.RootURI = lsp.DocumentURI(root)
+	state.IndexWorkspace()
+
+	state.OpenDocument(uri, 1, testOperation)
+	diagnostics := state.Diagnostics(uri)
+
+	is.Equal(len(diagnostics), 2)
+	is.Equal(diagnostics[0].Range, LineRange(6, 27, 63))
+	is.Equal(diagnostics[0].Severity, 1)
+	is.Equal(diagnostics[0].Message, "unable to resolve 'operations.services.apply_visibility', "+root+"/slices/domain/operations/services/apply_visibility.rb does not exist")
+	is.Equal(diagnostics[1].Range, LineRange(7, 9, 9))
+}
+
+func TestGetDiagnosticsForFileOutsideSlices(t *testing.T) {
+	is := is.New(t)
+
+	const action = "module GoalsService\n  module Actions\n    class Show\n      include Deps[\"repos.goal_repo\", \"\"]\n    end\n  end\nend\n"
+	root := NewTestWorkspace(t, map[string]string{
+		"config/app.rb":          "module GoalsService\n  class App < Hanami::App\n  end\nend\n",
+		"app/actions/show.rb":    action,
+		"lib/tasks/reindex.rb":   action,
+		"app/repos/user_repo.rb": "",
+	})
+
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+	state.RootURI = lsp.DocumentURI(root)
+	state.IndexWorkspace()
+
+	t.Run("it reports keys missing from app", func(t *testing.T) {
+		uri := root + "/app/actions/show.rb"
+		state.OpenDocument(uri, 1, action)
+		diagnostics := state.Diagnostics(uri)
+
+		is.Equal(len(diagnostics), 2)
+		is.Equal(diagnostics[0].Range, LineRange(3, 20, 35))
+		is.Equal(diagnostics[0].Message, "unable to resolve 'repos.goal_repo', "+root+"/app/repos/goal_repo.rb does not exist")
+	})
+
+	t.Run("it reports keys missing from lib", func(t *testing.T) {
+		uri := root + "/lib/tasks/reindex.rb"
+		state.OpenDocument(uri, 1, action)
+		diagnostics := state.Diagnostics(uri)
+
+		is.Equal(len(diagnostics), 2)
+		is.Equal(diagnostics[0].Message, "unable to resolve 'repos.goal_repo', "+root+"/lib/repos/goal_repo.rb does not exist")
+	})
+
+	t.Run("it reports keys it cannot place in a container", func(t *testing.T) {
+		uri := root + "/config/routes.rb"
+		state.OpenDocument(uri, 1, action)
+		diagnostics := state.Diagnostics(uri)
+
+		is.Equal(len(diagnostics), 2)
+		is.Equal(diagnostics[0].Message, "unable to resolve 'repos.goal_repo', unable to infer current slice name")
+	})
+}
+
+func TestGetDefinitionURIWithoutIndex(t *testing.T) {
+	is := is.New(t)
+
+	rootURI := "file:///Users/ayden.aba/code/goals+service (copy)"
+	state := NewState(
+		log.New(os.Stdout, "test", 1),
+	)
+
+	receivedURI, err := state.GetDefinitionURI(`"operations.transaction"`, rootURI+"/slices/domain/operations/create_goal.rb", rootURI)
+	is.NoErr(err)
+	is.Equal(receivedURI, rootURI+"/slices/domain/operations/transaction.rb")
+}
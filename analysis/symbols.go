@@ -0,0 +1,203 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"sort"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// outlineNode is a symbol being nested into the outline.
+type outlineNode struct {
+	symbol   lsp.DocumentSymbol
+	children []*outlineNode
+	// Only modules, classes and methods have children
+	container bool
+}
+
+// DocumentSymbols returns the outline of the document parsed into root: its
+// modules, classes and methods, with the Deps entries, operation steps, action
+// params and view exposures nested in the declaration they appear in.
+func DocumentSymbols(lib *queries.Library, root *sitter.Node, document []byte) []lsp.DocumentSymbol {
+	var nodes []*outlineNode
+
+	q := lib.Get(queries.Symbols)
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, root)
+
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+
+		m = qc.FilterPredicates(m, document)
+
+		var declaration, name *sitter.Node
+		var kind string
+		for _, c := range m.Captures {
+			switch captureName := q.CaptureNameForId(c.Index); captureName {
+			case "name":
+				name = c.Node
+			case "module", "class", "method", "step", "params", "expose":
+				declaration, kind = c.Node, captureName
+			}
+		}
+
+		if declaration == nil {
+			continue
+		}
+
+		if node, ok := newOutlineNode(kind, declaration, name, document); ok {
+			nodes = append(nodes, node)
+		}
+	}
+
+	for _, entry := range DepsEntries(lib, root, document) {
+		// Editors reject outlines with unnamed symbols, e.g. for the empty
+		// string left by auto-paired quotes while typing a key
+		if entry.Alias == "" {
+			continue
+		}
+
+		nodes = append(nodes, &outlineNode{symbol: lsp.DocumentSymbol{
+			Name:           entry.Alias,
+			Detail:         entry.Key,
+			Kind:           lsp.SymbolKindField,
+			Range:          entry.Range,
+			SelectionRange: entry.Range,
+		}})
+	}
+
+	return nestOutline(nodes)
+}
+
+func newOutlineNode(kind string, declaration *sitter.Node, name *sitter.Node, document []byte) (*outlineNode, bool) {
+	node := &outlineNode{symbol: lsp.DocumentSymbol{Range: nodeRange(declaration, document)}}
+
+	switch kind {
+	case "module", "class", "method":
+		if name == nil {
+			return nil, false
+		}
+
+		node.container = true
+		node.symbol.Name = name.Content(document)
+		node.symbol.SelectionRange = nodeRange(name, document)
+		node.symbol.Kind = map[string]int{
+			"module": lsp.SymbolKindModule,
+			"class":  lsp.SymbolKindClass,
+			"method": lsp.SymbolKindMethod,
+		}[kind]
+	case "step":
+		if name == nil {
+			return nil, false
+		}
+
+		node.symbol.Name = stepName(name, document)
+		node.symbol.Detail = "step"
+		node.symbol.Kind = lsp.SymbolKindFunction
+		node.symbol.SelectionRange = nodeRange(name, document)
+	case "params":
+		node.symbol.Name = "params"
+		node.symbol.Kind = lsp.SymbolKindStruct
+		node.symbol.SelectionRange = nodeRange(declaration.ChildByFieldName("method"), document)
+	case "expose":
+		if name == nil {
+			return nil, false
+		}
+
+		// A single `expose` may declare several exposures
+		node.symbol.Name = strings.TrimPrefix(name.Content(document), ":")
+		node.symbol.Detail = "expose"
+		node.symbol.Kind = lsp.SymbolKindProperty
+		node.symbol.Range = nodeRange(name, document)
+		node.symbol.SelectionRange = nodeRange(name, document)
+	default:
+		return nil, false
+	}
+
+	return node, true
+}
+
+// stepName returns the name of the step declared by the first argument of a
+// `step` call, e.g. `step :validate` or `step validate(input)`.
+func stepName(argument *sitter.Node, document []byte) string {
+	switch argument.Type() {
+	case "simple_symbol":
+		return strings.TrimPrefix(argument.Content(document), ":")
+	case "call":
+		if method := argument.ChildByFieldName("method"); method != nil {
+			return method.Content(document)
+		}
+	}
+
+	return argument.Content(document)
+}
+
+// nestOutline places each node inside the innermost container whose range
+// holds it.
+func nestOutline(nodes []*outlineNode) []lsp.DocumentSymbol {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i].symbol.Range, nodes[j].symbol.Range
+		if a.Start != b.Start {
+			return positionBefore(a.Start, b.Start)
+		}
+		// Outer declarations first when they start at the same position
+		return positionBefore(b.End, a.End)
+	})
+
+	var roots []*outlineNode
+	var open []*outlineNode
+	for _, node := range nodes {
+		for len(open) > 0 && !rangeContains(open[len(open)-1].symbol.Range, node.symbol.Range) {
+			open = open[:len(open)-1]
+		}
+
+		if len(open) > 0 {
+			parent := open[len(open)-1]
+			parent.children = append(parent.children, node)
+		} else {
+			roots = append(roots, node)
+		}
+
+		if node.container {
+			open = append(open, node)
+		}
+	}
+
+	return outlineSymbols(roots)
+}
+
+func outlineSymbols(nodes []*outlineNode) []lsp.DocumentSymbol {
+	symbols := make([]lsp.DocumentSymbol, 0, len(nodes))
+	for _, node := range nodes {
+		symbol := node.symbol
+		if len(node.children) > 0 {
+			symbol.Children = outlineSymbols(node.children)
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols
+}
+
+func (s *State) TextDocumentDocumentSymbol(id lsp.ID, uri string) lsp.DocumentSymbolResponse {
+	response := lsp.DocumentSymbolResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: []lsp.DocumentSymbol{},
+	}
+
+	document, root, err := s.SyntaxTree(uri)
+	if err != nil {
+		return response
+	}
+
+	response.Result = DocumentSymbols(s.Queries, root, document)
+	return response
+}
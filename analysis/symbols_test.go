@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const testSymbolsOperation = `module Domain
+  module Operations
+    class CreateGoal < Domain::Operation
+      include Deps["repositories.goal_repo", notify: "collaborations.operations.notify"]
+
+      def call(input)
+        attrs = step validate(input)
+        step :persist
+      end
+
+      def self.build
+      end
+    end
+  end
+end
+`
+
+const testSymbolsAction = `module Web
+  module Actions
+    class Create < Web::Action
+      params do
+        required(:title).filled(:string)
+      end
+
+      def handle(request, response)
+      end
+    end
+  end
+end
+`
+
+const testSymbolsView = `module Web
+  module Views
+    class Show < Web::View
+      expose :goal, :owner
+    end
+  end
+end
+`
+
+// outline flattens symbols into "name (detail)" lines, indented by depth.
+func outline(symbols []lsp.DocumentSymbol, depth int) []string {
+	var lines []string
+	for _, s := range symbols {
+		line := s.Name
+		if s.Detail != "" {
+			line += " (" + s.Detail + ")"
+		}
+		for range depth {
+			line = "  " + line
+		}
+
+		lines = append(lines, line)
+		lines = append(lines, outline(s.Children, depth+1)...)
+	}
+
+	return lines
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	is := is.New(t)
+
+	symbols := func(document string) []lsp.DocumentSymbol {
+		return DocumentSymbols(queries.Default, parseRuby([]byte(document)).RootNode(), []byte(document))
+	}
+
+	t.Run("operations list their dependencies and steps", func(t *testing.T) {
+		is.Equal(outline(symbols(testSymbolsOperation), 0), []string{
+			"Domain",
+			"  Operations",
+			"    CreateGoal",
+			"      goal_repo (repositories.goal_repo)",
+			"      notify (collaborations.operations.notify)",
+			"      call",
+			"        validate (step)",
+			"        persist (step)",
+			"      build",
+		})
+	})
+
+	t.Run("dependencies without a key are left out", func(t *testing.T) {
+		document := "class CreateGoal\n  include Deps[\"repositories.goal_repo\", \"\"]\nend\n"
+
+		is.Equal(outline(symbols(document), 0), []string{
+			"CreateGoal",
+			"  goal_repo (repositories.goal_repo)",
+		})
+	})
+
+	t.Run("actions list their params block", func(t *testing.T) {
+		is.Equal(outline(symbols(testSymbolsAction), 0), []string{
+			"Web",
+			"  Actions",
+			"    Create",
+			"      params",
+			"      handle",
+		})
+	})
+
+	t.Run("views list each exposure", func(t *testing.T) {
+		is.Equal(outline(symbols(testSymbolsView), 0), []string{
+			"Web",
+			"  Views",
+			"    Show",
+			"      goal (expose)",
+			"      owner (expose)",
+		})
+	})
+
+	t.Run("symbols have the kind and ranges of their declaration", func(t *testing.T) {
+		class := symbols(testSymbolsOperation)[0].Children[0].Children[0]
+
+		is.Equal(class.Kind, lsp.SymbolKindClass)
+		is.Equal(class.Range, lsp.Range{Start: lsp.Position{Line: 2, Character: 4}, End: lsp.Position{Line: 12, Character: 7}})
+		is.Equal(class.SelectionRange, lsp.Range{Start: lsp.Position{Line: 2, Character: 10}, End: lsp.Position{Line: 2, Character: 20}})
+		is.Equal(class.Children[0].Kind, lsp.SymbolKindField)
+	})
+}
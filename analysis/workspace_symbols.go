@@ -0,0 +1,310 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// maxWorkspaceSymbols bounds the number of results of a single query
+const maxWorkspaceSymbols = 100
+
+// symbolTable holds the classes, modules and container keys of a workspace,
+// and the Deps entries and calls of each file. It is built once per index, on
+// first use, and then searched in memory.
+type symbolTable struct {
+	lib     *queries.Library
+	once    sync.Once
+	symbols []workspaceSymbol
+	// Map of file URI to its Deps entries and calls
+	files map[string]fileInjections
+	// When the files were read, set once loaded
+	loadedAt time.Time
+}
+
+type workspaceSymbol struct {
+	lsp.SymbolInformation
+	// Lower cased name, matched against queries
+	search string
+}
+
+// load builds the table from the components and files of idx.
+func (t *symbolTable) load(idx *Index) {
+	t.once.Do(func() {
+		t.loadedAt = time.Now()
+
+		for _, container := range idx.containerNames() {
+			for _, key := range idx.Keys(container) {
+				c, _ := idx.Lookup(container, key)
+				t.add(lsp.SymbolInformation{
+					Name:          c.QualifiedKey(),
+					Kind:          lsp.SymbolKindKey,
+					Location:      lsp.Location{URI: c.URI},
+					ContainerName: container,
+				})
+			}
+		}
+
+		t.files = make(map[string]fileInjections, len(idx.Files))
+		for i, file := range parseFiles(t.lib, idx.Files) {
+			if !file.ok {
+				continue
+			}
+
+			for _, d := range file.declarations {
+				t.add(d)
+			}
+			t.files[idx.Files[i]] = file.injections
+		}
+	})
+}
+
+// injections returns the Deps entries and calls of the file at uri, loading
+// the table from idx first if needed.
+func (t *symbolTable) injections(idx *Index, uri string) (fileInjections, bool) {
+	t.load(idx)
+
+	file, ok := t.files[uri]
+	return file, ok
+}
+
+func (t *symbolTable) add(symbol lsp.SymbolInformation) {
+	t.symbols = append(t.symbols, workspaceSymbol{SymbolInformation: symbol, search: strings.ToLower(symbol.Name)})
+}
+
+type parsedFile struct {
+	declarations []lsp.SymbolInformation
+	injections   fileInjections
+	ok           bool
+}
+
+// parseFiles returns the class and module declarations, Deps entries and
+// calls of each file, parsing them in parallel.
+func parseFiles(lib *queries.Library, uris []string) []parsedFile {
+	files := make([]parsedFile, len(uris))
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				document, err := os.ReadFile(URIToPath(uris[i]))
+				if err != nil {
+					continue
+				}
+
+				root := parseRuby(document).RootNode()
+				files[i] = parsedFile{
+					declarations: classDeclarations(lib, root, document, uris[i]),
+					injections:   parseInjections(lib, root, document),
+					ok:           true,
+				}
+			}
+		}()
+	}
+
+	for i := range uris {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return files
+}
+
+// classDeclarations returns every class and module declared in the document
+// parsed into root, named with the modules and classes they are nested in.
+func classDeclarations(lib *queries.Library, root *sitter.Node, document []byte, uri string) []lsp.SymbolInformation {
+	var symbols []lsp.SymbolInformation
+
+	q := lib.Get(queries.Classes)
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, root)
+
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+
+		m = qc.FilterPredicates(m, document)
+		for _, c := range m.Captures {
+			if q.CaptureNameForId(c.Index) != "name" {
+				continue
+			}
+
+			kind := lsp.SymbolKindClass
+			if c.Node.Parent().Type() == "module" {
+				kind = lsp.SymbolKindModule
+			}
+
+			namespace := enclosingNamespace(c.Node.Parent(), document)
+			name := c.Node.Content(document)
+			if namespace != "" {
+				name = namespace + "::" + name
+			}
+
+			symbols = append(symbols, lsp.SymbolInformation{
+				Name:          name,
+				Kind:          kind,
+				Location:      lsp.Location{URI: uri, Range: nodeRange(c.Node, document)},
+				ContainerName: namespace,
+			})
+		}
+	}
+
+	return symbols
+}
+
+// enclosingNamespace returns the names of the classes and modules that n is
+// nested in, e.g. "Domain::Operations".
+func enclosingNamespace(n *sitter.Node, document []byte) string {
+	var names []string
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if p.Type() != "class" && p.Type() != "module" {
+			continue
+		}
+
+		if name := p.ChildByFieldName("name"); name != nil {
+			names = append([]string{name.Content(document)}, names...)
+		}
+	}
+
+	return strings.Join(names, "::")
+}
+
+// WorkspaceSymbols returns the classes, modules and container keys matching
+// every whitespace separated term of query, best matches first.
+func (idx *Index) WorkspaceSymbols(query string) []lsp.SymbolInformation {
+	idx.symbols.load(idx)
+
+	terms := strings.Fields(strings.ToLower(query))
+
+	type match struct {
+		symbol *workspaceSymbol
+		score  int
+	}
+	var matches []match
+
+	for i := range idx.symbols.symbols {
+		symbol := &idx.symbols.symbols[i]
+
+		score := 0
+		matched := true
+		for _, term := range terms {
+			s, ok := fuzzyScore(term, symbol.search, symbol.Name)
+			if !ok {
+				matched = false
+				break
+			}
+			score += s
+		}
+
+		if matched {
+			matches = append(matches, match{symbol: symbol, score: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.symbol.Name) != len(b.symbol.Name) {
+			return len(a.symbol.Name) < len(b.symbol.Name)
+		}
+		return a.symbol.Name < b.symbol.Name
+	})
+
+	results := make([]lsp.SymbolInformation, 0, min(len(matches), maxWorkspaceSymbols))
+	for _, m := range matches[:min(len(matches), maxWorkspaceSymbols)] {
+		results = append(results, m.symbol.SymbolInformation)
+	}
+
+	return results
+}
+
+// fuzzyScore matches the characters of term in order anywhere in candidate,
+// the lower cased name. Runs of consecutive characters, characters starting a
+// word of name and exact substrings score higher.
+func fuzzyScore(term, candidate string, name string) (int, bool) {
+	score, run, i := 0, 0, 0
+	for j := 0; j < len(candidate) && i < len(term); j++ {
+		if candidate[j] != term[i] {
+			run = 0
+			continue
+		}
+
+		run++
+		score += run
+		if isWordStart(name, j) {
+			score += 3
+		}
+		i++
+	}
+
+	if i < len(term) {
+		return 0, false
+	}
+
+	if strings.Contains(candidate, term) {
+		score += 2 * len(term)
+	}
+
+	return score, true
+}
+
+// isWordStart reports whether the byte at i starts a word of name, after a
+// separator or as the capital of a CamelCase word.
+func isWordStart(name string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	if i >= len(name) {
+		return false
+	}
+
+	switch name[i-1] {
+	case '.', '_', ':', '/':
+		return true
+	}
+
+	return name[i] >= 'A' && name[i] <= 'Z'
+}
+
+// containerNames returns the sorted names of every container with components.
+func (idx *Index) containerNames() []string {
+	names := make([]string, 0, len(idx.Containers))
+	for name := range idx.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (s *State) WorkspaceSymbol(id lsp.ID, query string) lsp.WorkspaceSymbolResponse {
+	response := lsp.WorkspaceSymbolResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: []lsp.SymbolInformation{},
+	}
+
+	if s.Index == nil {
+		return response
+	}
+
+	response.Result = s.Index.WorkspaceSymbols(query)
+	return response
+}
@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"fmt"
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestWorkspaceSymbols(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"config/app.rb": "module GoalsService\n  class App < Hanami::App\n  end\nend\n",
+		"slices/domain/operations/commands/create_published_goal.rb": "module Domain\n  module Operations\n    module Commands\n      class CreatePublishedGoal\n      end\n    end\n  end\nend\n",
+		"slices/domain/operations/commands/create_draft_goal.rb":     "module Domain::Operations::Commands\n  class CreateDraftGoal\n  end\nend\n",
+		"slices/domain/repositories/goal_repo.rb":                    "",
+	})
+
+	idx, err := BuildIndex(queries.Default, root, IndexConfig{})
+	is.NoErr(err)
+
+	names := func(symbols []lsp.SymbolInformation) []string {
+		var names []string
+		for _, s := range symbols {
+			names = append(names, s.Name)
+		}
+		return names
+	}
+
+	t.Run("it matches container keys by every term", func(t *testing.T) {
+		symbols := idx.WorkspaceSymbols("create_pub goal")
+
+		is.Equal(symbols[0].Name, "domain.operations.commands.create_published_goal")
+		is.Equal(symbols[0].Kind, lsp.SymbolKindKey)
+		is.Equal(symbols[0].ContainerName, "domain")
+		is.Equal(symbols[0].Location.URI, root+"/slices/domain/operations/commands/create_published_goal.rb")
+	})
+
+	t.Run("it matches classes with their namespace", func(t *testing.T) {
+		symbols := idx.WorkspaceSymbols("CreatePub")
+
+		is.Equal(symbols[0].Name, "Domain::Operations::Commands::CreatePublishedGoal")
+		is.Equal(symbols[0].Kind, lsp.SymbolKindClass)
+		is.Equal(symbols[0].ContainerName, "Domain::Operations::Commands")
+		is.Equal(symbols[0].Location.Range.Start, lsp.Position{Line: 3, Character: 12})
+	})
+
+	t.Run("it ranks matches at the start of words first", func(t *testing.T) {
+		is.Equal(names(idx.WorkspaceSymbols("cdg")), []string{
+			"domain.operations.commands.create_draft_goal",
+			"Domain::Operations::Commands::CreateDraftGoal",
+			"domain.operations.commands.create_published_goal",
+			"Domain::Operations::Commands::CreatePublishedGoal",
+		})
+	})
+
+	t.Run("it includes modules", func(t *testing.T) {
+		symbols := idx.WorkspaceSymbols("goalsservice")
+		is.Equal(names(symbols), []string{"GoalsService", "GoalsService::App"})
+		is.Equal(symbols[0].Kind, lsp.SymbolKindModule)
+	})
+
+	t.Run("it returns nothing when a term does not match", func(t *testing.T) {
+		is.Equal(len(idx.WorkspaceSymbols("goal zzz")), 0)
+	})
+}
+
+func TestFuzzyScore(t *testing.T) {
+	is := is.New(t)
+
+	_, ok := fuzzyScore("cpg", "create_published_goal", "create_published_goal")
+	is.True(ok)
+	_, ok = fuzzyScore("gpc", "create_published_goal", "create_published_goal")
+	is.True(!ok)
+
+	exact, _ := fuzzyScore("goal", "goal_repo", "goal_repo")
+	scattered, _ := fuzzyScore("goal", "go_all", "go_all")
+	is.True(exact > scattered)
+
+	camel, _ := fuzzyScore("cpg", "createpublishedgoal", "CreatePublishedGoal")
+	flat, _ := fuzzyScore("cpg", "createpublishedgoal", "Createpublishedgoal")
+	is.True(camel > flat)
+}
+
+func BenchmarkWorkspaceSymbols(b *testing.B) {
+	files := map[string]string{}
+	for i := 0; i < 5000; i++ {
+		slice := fmt.Sprintf("slice_%d", i%20)
+		files[fmt.Sprintf("slices/%s/operations/commands/command_%d.rb", slice, i)] = fmt.Sprintf(
+			"module %s\n  module Operations\n    module Commands\n      class Command%d\n        include Deps[\"repositories.repo\"]\n\n        def call(input)\n          repo.create(input)\n        end\n      end\n    end\n  end\nend\n",
+			Camelize(slice), i)
+	}
+
+	idx, err := BuildIndex(queries.Default, NewTestWorkspace(b, files), IndexConfig{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	idx.symbols.load(idx)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.WorkspaceSymbols("cmd_42 commands")
+	}
+}
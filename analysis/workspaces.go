@@ -0,0 +1,60 @@
+package analysis
+
+import (
+	"hanamilsp/queries"
+	"sync"
+	"time"
+)
+
+// Workspaces shares indexed workspaces between the states of several editor
+// connections, so that a workspace root is only walked once no matter how
+// many editors have it open.
+type Workspaces struct {
+	mu sync.Mutex
+	// Map of workspace root and index exclusions to its shared index
+	workspaces map[string]*sharedWorkspace
+}
+
+type sharedWorkspace struct {
+	// Held while building, so concurrent loads of a root wait for one build
+	mu      sync.Mutex
+	builtAt time.Time
+	index   *Index
+	queries *queries.Library
+}
+
+func NewWorkspaces() *Workspaces {
+	return &Workspaces{
+		workspaces: map[string]*sharedWorkspace{},
+	}
+}
+
+// load returns the index and queries of the workspace identified by key,
+// calling build the first time the key is seen. Concurrent loads of the same
+// key wait for a single build.
+func (w *Workspaces) load(key string, build func() (*Index, *queries.Library)) (*Index, *queries.Library) {
+	return w.reload(key, time.Time{}, build)
+}
+
+// reload is like load, but also calls build when the workspace was last built
+// before since. Connections reacting to the same change on disk only rebuild
+// it once.
+func (w *Workspaces) reload(key string, since time.Time, build func() (*Index, *queries.Library)) (*Index, *queries.Library) {
+	w.mu.Lock()
+	ws, ok := w.workspaces[key]
+	if !ok {
+		ws = &sharedWorkspace{}
+		w.workspaces[key] = ws
+	}
+	w.mu.Unlock()
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.index == nil || ws.builtAt.Before(since) {
+		ws.builtAt = time.Now()
+		ws.index, ws.queries = build()
+	}
+
+	return ws.index, ws.queries
+}
@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"hanamilsp/lsp"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestWorkspaces(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"slices/domain/operations/transaction.rb": "module Domain\nend\n",
+		"slices/collaborations/repo.rb":           "module Collaborations\nend\n",
+	})
+
+	workspaces := NewWorkspaces()
+	newState := func(aliases map[string]string) *State {
+		state := NewState(log.New(os.Stdout, "test", 1))
+		state.RootURI = lsp.DocumentURI("file://" + root)
+		state.Workspaces = workspaces
+		state.Config.Slices = SliceOptions{Aliases: aliases}
+		return state
+	}
+
+	states := []*State{
+		newState(map[string]string{"dom": "domain"}),
+		newState(map[string]string{"collab": "collaborations"}),
+		newState(nil),
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range states {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.IndexWorkspace()
+		}()
+	}
+	wg.Wait()
+
+	t.Run("the workspace is indexed once", func(t *testing.T) {
+		containers := reflect.ValueOf(states[0].Index.Containers).Pointer()
+		for _, s := range states[1:] {
+			is.Equal(reflect.ValueOf(s.Index.Containers).Pointer(), containers)
+			is.Equal(s.Queries, states[0].Queries)
+		}
+	})
+
+	t.Run("aliases stay per state", func(t *testing.T) {
+		is.Equal(states[0].Index.Aliases, map[string]string{"dom": "domain"})
+		is.Equal(states[1].Index.Aliases, map[string]string{"collab": "collaborations"})
+		is.Equal(states[2].Index.Aliases, map[string]string{})
+	})
+
+	t.Run("other roots are indexed separately", func(t *testing.T) {
+		other := NewState(log.New(os.Stdout, "test", 1))
+		other.RootURI = lsp.DocumentURI("file://" + t.TempDir())
+		other.Workspaces = workspaces
+		other.IndexWorkspace()
+
+		is.Equal(len(other.Index.Containers), 0)
+	})
+}
+
+func TestRebuildIndex(t *testing.T) {
+	is := is.New(t)
+
+	root := NewTestWorkspace(t, map[string]string{
+		"slices/domain/operations/transaction.rb": "module Domain\nend\n",
+	})
+
+	workspaces := NewWorkspaces()
+	states := make([]*State, 2)
+	for i := range states {
+		states[i] = NewState(log.New(os.Stdout, "test", 1))
+		states[i].RootURI = lsp.DocumentURI("file://" + root)
+		states[i].Workspaces = workspaces
+		states[i].IndexWorkspace()
+	}
+
+	changedAt := time.Now()
+	is.NoErr(os.WriteFile(filepath.Join(root, "slices/domain/operations/publish.rb"), []byte("module Domain\nend\n"), 0644))
+
+	t.Run("it picks up files changed on disk", func(t *testing.T) {
+		states[0].SetIndex(states[0].RebuildIndex(changedAt, IndexConfig{}))
+
+		_, ok := states[0].Index.Lookup("domain", "operations.publish")
+		is.True(ok)
+	})
+
+	t.Run("other connections reuse the rebuilt index", func(t *testing.T) {
+		states[1].SetIndex(states[1].RebuildIndex(changedAt, IndexConfig{}))
+
+		is.Equal(reflect.ValueOf(states[1].Index.Containers).Pointer(), reflect.ValueOf(states[0].Index.Containers).Pointer())
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hanamilsp/analysis"
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"time"
+)
+
+// Requests the server sends to the client
+const (
+	CLIENT_REGISTER_CAPABILITY = "client/registerCapability"
+	WORKSPACE_CONFIGURATION    = "workspace/configuration"
+)
+
+// clientCallTimeout is how long a request to the client waits for its
+// response.
+const clientCallTimeout = 30 * time.Second
+
+// errClientUnsupported is returned when the client did not advertise the
+// capability a request to it needs.
+var errClientUnsupported = errors.New("not supported by the client")
+
+// Files that change the index when they are created, changed or deleted
+var watchedFiles = []lsp.FileSystemWatcher{
+	{GlobPattern: "**/*.rb"},
+	{GlobPattern: "**/" + analysis.ProjectConfigFile},
+	{GlobPattern: "**/" + queries.OverrideDir + "/*.scm"},
+}
+
+// call sends a request to the client, giving up after clientCallTimeout.
+func (h *Handler) call(ctx context.Context, method string, params any, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, clientCallTimeout)
+	defer cancel()
+
+	return h.Conn.Call(ctx, method, params, result)
+}
+
+func (h *Handler) registerCapability(ctx context.Context, registrations ...lsp.Registration) error {
+	return h.call(ctx, CLIENT_REGISTER_CAPABILITY, lsp.RegistrationParams{Registrations: registrations}, nil)
+}
+
+// workspaceConfiguration pulls the settings of each item from the client.
+func (h *Handler) workspaceConfiguration(ctx context.Context, items ...lsp.ConfigurationItem) (lsp.ConfigurationResult, error) {
+	if !h.clientCapabilities.Workspace.Configuration {
+		return nil, errClientUnsupported
+	}
+
+	var result lsp.ConfigurationResult
+	err := h.call(ctx, WORKSPACE_CONFIGURATION, lsp.ConfigurationParams{Items: items}, &result)
+	return result, err
+}
+
+// registerCapabilities asks the client to notify the server of changes to
+// watchedFiles and to its settings, for those it supports registering for
+// dynamically.
+func (h *Handler) registerCapabilities() {
+	var registrations []lsp.Registration
+	if h.clientCapabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration {
+		registrations = append(registrations, lsp.Registration{
+			ID:              "hanamilsp/watchedFiles",
+			Method:          WORKSPACE_DID_CHANGE_WATCHED_FILES,
+			RegisterOptions: lsp.DidChangeWatchedFilesRegistrationOptions{Watchers: watchedFiles},
+		})
+	}
+	if h.clientCapabilities.Workspace.DidChangeConfiguration.DynamicRegistration {
+		registrations = append(registrations, lsp.Registration{
+			ID:     "hanamilsp/configuration",
+			Method: WORKSPACE_DID_CHANGE_CONFIGURATION,
+		})
+	}
+
+	if len(registrations) == 0 {
+		return
+	}
+
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+
+		if err := h.registerCapability(context.Background(), registrations...); err != nil {
+			h.Logger.Printf("error: unable to register capabilities, err: %s", err)
+		}
+	}()
+}
+
+// reindexWorkspace rebuilds the index in the background, then swaps it in
+// once no request is reading it.
+func (h *Handler) reindexWorkspace(changedAt time.Time) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+
+		h.reindexMu.Lock()
+		defer h.reindexMu.Unlock()
+
+		unlock := h.readIndex()
+		config := h.State.Config.Index
+		unlock()
+
+		idx, lib := h.State.RebuildIndex(changedAt, config)
+
+		h.indexMu.Lock()
+		h.State.SetIndex(idx, lib)
+		h.indexMu.Unlock()
+
+		h.publishOpenDiagnostics()
+	}()
+}
+
+// readIndex holds the index for reading until the returned func is called.
+func (h *Handler) readIndex() func() {
+	h.indexMu.RLock()
+	return h.indexMu.RUnlock
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hanamilsp/analysis"
+	"hanamilsp/lsp"
+	"hanamilsp/rpc"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestServerRequests(t *testing.T) {
+	is := is.New(t)
+
+	root := t.TempDir()
+	is.NoErr(os.MkdirAll(filepath.Join(root, "slices", "domain", "operations"), 0755))
+	is.NoErr(os.WriteFile(filepath.Join(root, "slices", "domain", "operations", "transaction.rb"), []byte("module Domain\nend\n"), 0644))
+
+	h, c, served := newTestPipeHandler(t)
+
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootUri":"file://` + root + `","capabilities":{"workspace":{"didChangeWatchedFiles":{"dynamicRegistration":true}}}}}`)
+	is.True(bytes.Contains(c.receive(), []byte(`"id":1,"result":{"capabilities"`)))
+
+	t.Run("it registers file watchers once initialized", func(t *testing.T) {
+		c.send(`{"jsonrpc":"2.0","method":"initialized","params":{}}`)
+
+		var request struct {
+			ID     int                    `json:"id"`
+			Method string                 `json:"method"`
+			Params lsp.RegistrationParams `json:"params"`
+		}
+		is.NoErr(json.Unmarshal(c.receive(), &request))
+		is.Equal(request.Method, CLIENT_REGISTER_CAPABILITY)
+		is.Equal(request.Params.Registrations[0].Method, WORKSPACE_DID_CHANGE_WATCHED_FILES)
+
+		c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":null}`, request.ID))
+	})
+
+	t.Run("it re-indexes when watched files change", func(t *testing.T) {
+		publish := filepath.Join(root, "slices", "domain", "operations", "publish.rb")
+		is.NoErr(os.WriteFile(publish, []byte("module Domain\nend\n"), 0644))
+
+		c.send(`{"jsonrpc":"2.0","method":"workspace/didChangeWatchedFiles","params":{"changes":[{"uri":"file://` + publish + `","type":1}]}}`)
+
+		indexed := func() bool {
+			defer h.readIndex()()
+			_, ok := h.State.Index.Lookup("domain", "operations.publish")
+			return ok
+		}
+		for deadline := time.Now().Add(5 * time.Second); !indexed(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("publish.rb was not indexed")
+			}
+		}
+	})
+
+	t.Run("it does not send requests the client does not support", func(t *testing.T) {
+		_, err := h.workspaceConfiguration(context.Background(), lsp.ConfigurationItem{Section: "hanamilsp"})
+		is.True(errors.Is(err, errClientUnsupported))
+	})
+
+	t.Run("shutdown waits for requests blocked on the client", func(t *testing.T) {
+		handleAsync(h, "test/register", []byte(`{"jsonrpc":"2.0","id":2,"method":"test/register"}`), func(_ context.Context, request lsp.ShutdownRequest) (lsp.NullResponse, error) {
+			err := h.registerCapability(context.Background(), lsp.Registration{ID: "test", Method: WORKSPACE_DID_CHANGE_CONFIGURATION})
+			return lsp.NewNullResponse(&request.ID), err
+		})
+
+		var request struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		is.NoErr(json.Unmarshal(c.receive(), &request))
+		is.Equal(request.Method, CLIENT_REGISTER_CAPABILITY)
+
+		c.send(`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`)
+		c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":null}`, request.ID))
+
+		is.Equal(string(c.receive()), `{"jsonrpc":"2.0","id":2,"result":null}`)
+		is.Equal(string(c.receive()), `{"jsonrpc":"2.0","id":3,"result":null}`)
+	})
+
+	t.Run("closing the connection fails pending requests", func(t *testing.T) {
+		errs := make(chan error)
+		go func() {
+			errs <- h.registerCapability(context.Background(), lsp.Registration{ID: "test", Method: WORKSPACE_DID_CHANGE_CONFIGURATION})
+		}()
+
+		c.receive()
+		c.conn.Close()
+
+		is.True(errors.Is(<-errs, rpc.ErrClosed))
+		<-served
+	})
+}
+
+// newTestPipeHandler serves a handler over an in-memory connection, the
+// returned channel is closed once Serve returns.
+func newTestPipeHandler(t *testing.T) (*Handler, *testConn, chan struct{}) {
+	server, client := net.Pipe()
+	client.SetDeadline(time.Now().Add(10 * time.Second))
+
+	logger := getLogger("out.log")
+	h := NewHandler(logger, rpc.NewConn(server, server), analysis.NewState(logger))
+
+	served := make(chan struct{})
+	go func() {
+		h.Serve()
+		close(served)
+	}()
+	t.Cleanup(func() { client.Close() })
+
+	return h, &testConn{t: t, conn: client, reader: rpc.NewReader(client)}, served
+}
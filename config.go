@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hanamilsp/analysis"
+	"hanamilsp/lsp"
+	"time"
+)
+
+const WORKSPACE_DID_CHANGE_CONFIGURATION = "workspace/didChangeConfiguration"
+
+// configSection is the section of the editor's settings read by the server
+const configSection = "hanamilsp"
+
+func (h *Handler) handleDidChangeConfiguration(contents []byte) {
+	var notification lsp.DidChangeConfigurationNotification
+	if err := json.Unmarshal(contents, &notification); err != nil {
+		h.Logger.Printf("error: unable to unmarshal message for method '%s', err: %s", WORKSPACE_DID_CHANGE_CONFIGURATION, err)
+		return
+	}
+
+	// Clients using the pull model only say that something changed
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(notification.Params.Settings, &settings); err != nil || settings[configSection] == nil {
+		h.pullConfig()
+		return
+	}
+
+	h.applySettings(settings[configSection])
+}
+
+// pullConfig asks the client for the server's section of its settings, if it
+// supports `workspace/configuration`.
+func (h *Handler) pullConfig() {
+	if !h.clientCapabilities.Workspace.Configuration {
+		return
+	}
+
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+
+		result, err := h.workspaceConfiguration(context.Background(), lsp.ConfigurationItem{
+			ScopeURI: string(h.State.RootURI),
+			Section:  configSection,
+		})
+		if err != nil {
+			h.Logger.Printf("error: unable to pull configuration, err: %s", err)
+			return
+		}
+
+		if len(result) > 0 {
+			h.applySettings(result[0])
+		}
+	}()
+}
+
+// applySettings applies the editor's settings on top of the
+// initializationOptions.
+func (h *Handler) applySettings(settings json.RawMessage) {
+	config, err := analysis.ParseConfig(h.initializationOptions, settings)
+	if err != nil {
+		h.Logger.Printf("error: unable to parse settings, err: %s", err)
+	}
+
+	h.applyConfig(config)
+}
+
+// applyConfig switches to config while the server runs, re-indexing the
+// workspace or republishing diagnostics as needed.
+func (h *Handler) applyConfig(config analysis.Config) {
+	h.configureLogging(config.Log)
+
+	// Swapping the config in waits for the requests reading the index, so it
+	// is done in the background, in the order the configs were received
+	seq := h.configSeq.Add(1)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+
+		h.reindexMu.Lock()
+		defer h.reindexMu.Unlock()
+
+		if seq < h.appliedConfigSeq {
+			return
+		}
+		h.appliedConfigSeq = seq
+
+		h.indexMu.Lock()
+		reindex := h.State.SetConfig(config)
+		h.indexMu.Unlock()
+
+		if reindex {
+			h.reindexWorkspace(time.Now())
+			return
+		}
+
+		h.publishOpenDiagnostics()
+	}()
+}
+
+func (h *Handler) configureLogging(config analysis.LogConfig) {
+	if h.sharedLogger {
+		if config != (analysis.LogConfig{}) {
+			h.Logger.Println("warning: ignoring log settings, the log is shared by every connection")
+		}
+		return
+	}
+
+	out, ok := h.Logger.Writer().(*logOutput)
+	if !ok {
+		return
+	}
+
+	if err := out.configure(config); err != nil {
+		h.Logger.Printf("error: unable to configure logging, err: %s", err)
+	}
+}
+
+// publishOpenDiagnostics publishes the diagnostics of every open document
+// again, e.g. after the index or the configuration changed.
+func (h *Handler) publishOpenDiagnostics() {
+	for _, uri := range h.State.OpenDocuments() {
+		if version, ok := h.State.Version(uri); ok {
+			h.publishDiagnostics(uri, version)
+		}
+	}
+}
+
+// publishDiagnostics publishes the diagnostics of version of the open
+// document at uri. They are computed in the background, since reading the
+// index may wait for it to be replaced, which itself waits for slow requests,
+// and they are dropped if the document changed or closed in the meantime.
+func (h *Handler) publishDiagnostics(uri string, version int) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+
+		unlock := h.readIndex()
+		diagnostics := h.State.Diagnostics(uri)
+		unlock()
+
+		h.diagnosticsMu.Lock()
+		defer h.diagnosticsMu.Unlock()
+
+		if current, ok := h.State.Version(uri); !ok || current != version {
+			return
+		}
+
+		h.writeResponse(lsp.PublishDiagnosticsNotification{
+			Notification: lsp.Notification{
+				RPC:    "2.0",
+				Method: TEXT_DOCUMENT_PUBLISH_DIAGNOSTICS,
+			},
+			Params: lsp.PublishDiagnosticsParams{
+				URI:         uri,
+				Version:     &version,
+				Diagnostics: diagnostics,
+			},
+		})
+	}()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hanamilsp/analysis"
+	"hanamilsp/lsp"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestWorkspaceConfiguration(t *testing.T) {
+	is := is.New(t)
+
+	root := t.TempDir()
+	for _, rel := range []string{"slices/domain/operations/transaction.rb", "slices/collaborations/operations/notify.rb"} {
+		is.NoErr(os.MkdirAll(filepath.Join(root, filepath.Dir(rel)), 0755))
+		is.NoErr(os.WriteFile(filepath.Join(root, rel), []byte(""), 0644))
+	}
+	uri := "file://" + root + "/slices/collaborations/operations/notify.rb"
+
+	h, c, _ := newTestPipeHandler(t)
+
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootUri":"file://` + root + `",` +
+		`"initializationOptions":{"slices":{"aliases":{"dom":"domain"}}},` +
+		`"capabilities":{"workspace":{"configuration":true,"didChangeConfiguration":{"dynamicRegistration":true}}}}}`)
+	is.True(bytes.Contains(c.receive(), []byte(`"id":1,"result":{"capabilities"`)))
+
+	type request struct {
+		ID     int             `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	receiveRequest := func() request {
+		var r request
+		is.NoErr(json.Unmarshal(c.receive(), &r))
+		return r
+	}
+	receiveDiagnostics := func() []lsp.Diagnostic {
+		var n lsp.PublishDiagnosticsNotification
+		is.NoErr(json.Unmarshal(c.receive(), &n))
+		is.Equal(n.Method, TEXT_DOCUMENT_PUBLISH_DIAGNOSTICS)
+		return n.Params.Diagnostics
+	}
+	config := func() analysis.Config {
+		defer h.readIndex()()
+		return h.State.Config
+	}
+
+	t.Run("it pulls the configuration once initialized", func(t *testing.T) {
+		c.send(`{"jsonrpc":"2.0","method":"initialized","params":{}}`)
+
+		// Registration and the pull run concurrently
+		for range 2 {
+			r := receiveRequest()
+			switch r.Method {
+			case CLIENT_REGISTER_CAPABILITY:
+				is.True(bytes.Contains(r.Params, []byte(WORKSPACE_DID_CHANGE_CONFIGURATION)))
+				c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":null}`, r.ID))
+			case WORKSPACE_CONFIGURATION:
+				is.True(bytes.Contains(r.Params, []byte(`"section":"hanamilsp"`)))
+				c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":[{"diagnostics":{"unresolved-key":false}}]}`, r.ID))
+			default:
+				t.Fatalf("unexpected request: %s", r.Method)
+			}
+		}
+
+		for deadline := time.Now().Add(5 * time.Second); config().DiagnosticEnabled(analysis.DiagnosticUnresolvedKey); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("the pulled configuration was not applied")
+			}
+		}
+		is.Equal(config().Slices.Aliases, map[string]string{"dom": "domain"})
+
+		c.send(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"` + uri + `","version":1,"text":"include Deps[\"domain.operations.missing\"]\n"}}}`)
+		is.Equal(len(receiveDiagnostics()), 0)
+	})
+
+	t.Run("pushed settings are applied live", func(t *testing.T) {
+		c.send(`{"jsonrpc":"2.0","method":"workspace/didChangeConfiguration","params":{"settings":{"hanamilsp":{"log":{"level":"error"}}}}}`)
+
+		is.Equal(len(receiveDiagnostics()), 1)
+		is.Equal(config().Log.Level, "error")
+	})
+
+	t.Run("it pulls again when the settings are not pushed", func(t *testing.T) {
+		c.send(`{"jsonrpc":"2.0","method":"workspace/didChangeConfiguration","params":{"settings":null}}`)
+
+		r := receiveRequest()
+		is.Equal(r.Method, WORKSPACE_CONFIGURATION)
+		c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":[{"index":{"exclude":["domain"]}}]}`, r.ID))
+
+		// Diagnostics are published again once the workspace is re-indexed
+		is.Equal(len(receiveDiagnostics()), 1)
+
+		defer h.readIndex()()
+		_, ok := h.State.Index.Lookup("domain", "operations.transaction")
+		is.True(!ok)
+	})
+}
@@ -3,6 +3,7 @@ module hanamilsp
 go 1.22.5
 
 require (
-	github.com/matryer/is v1.4.1 // indirect
-	github.com/smacker/go-tree-sitter v0.0.0-20240625050157-a31a98a7c0f6 // indirect
+	github.com/matryer/is v1.4.1
+	github.com/smacker/go-tree-sitter v0.0.0-20240625050157-a31a98a7c0f6
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"hanamilsp/analysis"
+	"hanamilsp/lsp"
+	"hanamilsp/queries"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runGraph implements `hanamilsp graph`, printing the Deps injection graph of
+// the workspace at the optional root argument, the working directory by
+// default. It returns the process exit code.
+func runGraph(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "dot", "output `format`, one of "+strings.Join(analysis.GraphFormats, ", "))
+	slice := flags.String("slice", "", "only show injections from or into this `slice`")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: hanamilsp graph [flags] [root]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	root, err := filepath.Abs(flags.Arg(0))
+	if err == nil {
+		_, err = os.Stat(root)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "hanamilsp: %s\n", err)
+		return 1
+	}
+
+	// Like the server, keep going with what could be loaded and indexed
+	lib, err := queries.Load(filepath.Join(root, queries.OverrideDir))
+	if err != nil {
+		fmt.Fprintf(stderr, "hanamilsp: warning: %s\n", err)
+	}
+
+	// Built directly rather than with IndexWorkspace, which also parses every
+	// file for requests the command never makes
+	state := analysis.NewState(log.New(io.Discard, "", 0))
+	state.RootURI = lsp.DocumentURI(analysis.PathToURI(root))
+	idx, err := analysis.BuildIndex(lib, string(state.RootURI), state.Config.Index)
+	if err != nil {
+		fmt.Fprintf(stderr, "hanamilsp: warning: %s\n", err)
+	}
+	state.UseIndex(idx, lib)
+
+	graph, err := state.DependencyGraph(context.Background(), *slice)
+	if err == nil {
+		var out string
+		out, err = analysis.FormatGraph(graph, *format)
+		if err == nil {
+			_, err = io.WriteString(stdout, out)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "hanamilsp: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func (h *Handler) handleHanamiDependencyGraph(ctx context.Context, request lsp.DependencyGraphRequest) (lsp.DependencyGraphResponse, error) {
+	return h.State.HanamiDependencyGraph(ctx, request.ID, request.Params.Slice, request.Params.Format)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestRunGraph(t *testing.T) {
+	is := is.New(t)
+
+	root := t.TempDir()
+	files := map[string]string{
+		"slices/domain/operations/create_goal.rb": "module Domain\n  module Operations\n    class CreateGoal\n      include Deps[\"operations.transaction\", notify: \"billing.notify\"]\n    end\n  end\nend\n",
+		"slices/domain/operations/transaction.rb": "module Domain\n  module Operations\n    class Transaction\n    end\n  end\nend\n",
+		"slices/billing/notify.rb":                "module Billing\n  class Notify\n  end\nend\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		is.NoErr(os.MkdirAll(filepath.Dir(path), 0755))
+		is.NoErr(os.WriteFile(path, []byte(content), 0644))
+	}
+
+	t.Run("it prints the graph", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		is.Equal(runGraph([]string{"-slice", "billing", root}, &stdout, &stderr), 0)
+		is.Equal(stderr.String(), "")
+		is.Equal(stdout.String(), `digraph deps {
+  rankdir=LR;
+  subgraph "cluster_billing" {
+    label="billing";
+    n0 [label="billing.notify"];
+  }
+  subgraph "cluster_domain" {
+    label="domain";
+    n1 [label="domain.operations.create_goal"];
+  }
+  n1 -> n0;
+}
+`)
+	})
+
+	t.Run("it reports bad arguments", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		is.Equal(runGraph([]string{"-format", "svg", root}, &stdout, &stderr), 1)
+		is.Equal(stderr.String(), "hanamilsp: unknown graph format 'svg', expected one of json, dot, mermaid\n")
+
+		stderr.Reset()
+		is.Equal(runGraph([]string{filepath.Join(root, "missing")}, &stdout, &stderr), 1)
+		is.True(stderr.Len() > 0)
+	})
+}
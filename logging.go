@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hanamilsp/analysis"
+	"log"
+	"os"
+	"slices"
+	"sync"
+)
+
+// defaultLogPath is used until the editor configures another one
+const defaultLogPath = "out.log"
+
+// logOutput writes the log lines at or above level to the file at path, both
+// of which may be changed by the editor while the server runs.
+type logOutput struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	level int
+}
+
+func getLogger(filename string) *log.Logger {
+	logfile, err := openLogFile(filename)
+	if err != nil {
+		panic("hey, you didn't give me a good file")
+	}
+
+	return log.New(&logOutput{path: filename, file: logfile}, "[hanamilsp]", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+func openLogFile(filename string) (*os.File, error) {
+	return os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+}
+
+func (o *logOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if lineLevel(p) < o.level {
+		return len(p), nil
+	}
+
+	return o.file.Write(p)
+}
+
+func (o *logOutput) Sync() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.file.Sync()
+}
+
+// configure switches to the level and file in config, keeping the current
+// ones if they are invalid.
+func (o *logOutput) configure(config analysis.LogConfig) error {
+	var errs []error
+
+	level := 0
+	if config.Level != "" {
+		level = slices.Index(analysis.LogLevels, config.Level)
+		if level < 0 {
+			errs = append(errs, fmt.Errorf("unknown log level '%s'", config.Level))
+		}
+	}
+
+	path := config.Path
+	if path == "" {
+		path = defaultLogPath
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if level >= 0 {
+		o.level = level
+	}
+
+	if path != o.path {
+		file, err := openLogFile(path)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		o.file.Close()
+		o.file = file
+		o.path = path
+	}
+
+	return errors.Join(errs...)
+}
+
+// lineLevel returns the index in analysis.LogLevels of a log line, from the
+// "error:" or "warning:" its message starts with.
+func lineLevel(line []byte) int {
+	// The message follows the file and line number, e.g. "main.go:42: "
+	_, message, _ := bytes.Cut(line, []byte(": "))
+
+	switch {
+	case bytes.HasPrefix(message, []byte("error:")):
+		return slices.Index(analysis.LogLevels, "error")
+	case bytes.HasPrefix(message, []byte("warning:")):
+		return slices.Index(analysis.LogLevels, "warning")
+	}
+
+	return 0
+}
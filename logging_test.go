@@ -0,0 +1,52 @@
+package main
+
+import (
+	"hanamilsp/analysis"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestLogOutput(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	logger := getLogger(filepath.Join(dir, "first.log"))
+	out := logger.Writer().(*logOutput)
+
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		is.NoErr(err)
+		return string(b)
+	}
+
+	t.Run("it only writes lines at or above the level", func(t *testing.T) {
+		is.NoErr(out.configure(analysis.LogConfig{Level: "warning", Path: filepath.Join(dir, "first.log")}))
+
+		logger.Println("indexed 3 ruby files")
+		logger.Println("warning: got version 1 after version 2")
+		logger.Println("error: unable to read message")
+
+		contents := read("first.log")
+		is.True(!strings.Contains(contents, "indexed"))
+		is.True(strings.Contains(contents, "warning: got version"))
+		is.True(strings.Contains(contents, "error: unable to read"))
+	})
+
+	t.Run("it switches to another file", func(t *testing.T) {
+		is.NoErr(out.configure(analysis.LogConfig{Path: filepath.Join(dir, "second.log")}))
+
+		logger.Println("indexed 3 ruby files")
+		is.True(strings.Contains(read("second.log"), "indexed 3 ruby files"))
+	})
+
+	t.Run("it keeps the current level and file when they are invalid", func(t *testing.T) {
+		is.True(out.configure(analysis.LogConfig{Level: "verbose", Path: filepath.Join(dir, "missing", "third.log")}) != nil)
+
+		logger.Println("still here")
+		is.True(strings.Contains(read("second.log"), "still here"))
+	})
+}
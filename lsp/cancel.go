@@ -0,0 +1,11 @@
+package lsp
+
+type CancelNotification struct {
+	Notification
+	Params CancelParams `json:"params"`
+}
+
+type CancelParams struct {
+	// The id of the request to cancel
+	ID ID `json:"id"`
+}
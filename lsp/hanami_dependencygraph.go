@@ -0,0 +1,50 @@
+package lsp
+
+/**
+ * hanami/dependencyGraph is a custom request returning the graph of Deps
+ * injections in the workspace, optionally scoped to a single slice.
+ */
+type DependencyGraphRequest struct {
+	Request
+	Params DependencyGraphParams `json:"params"`
+}
+
+type DependencyGraphParams struct {
+	// Only keep injections from or into this slice when set
+	Slice string `json:"slice,omitempty"`
+	// One of "json" (the default), "dot" or "mermaid"
+	Format string `json:"format,omitempty"`
+}
+
+type DependencyGraphResponse struct {
+	Response
+	Result DependencyGraphResult `json:"result"`
+}
+
+type DependencyGraphResult struct {
+	DependencyGraph
+	// The graph rendered in the requested format, unless it is "json"
+	Content string `json:"content,omitempty"`
+}
+
+type DependencyGraph struct {
+	Nodes []DependencyGraphNode `json:"nodes"`
+	Edges []DependencyGraphEdge `json:"edges"`
+}
+
+type DependencyGraphNode struct {
+	// Qualified container key, e.g. "domain.operations.transaction"
+	Key       string `json:"key"`
+	Container string `json:"container"`
+	ClassName string `json:"className"`
+	URI       string `json:"uri"`
+}
+
+type DependencyGraphEdge struct {
+	// URI of the component declaring the Deps entry
+	From string `json:"from"`
+	// URI of the injected component
+	To string `json:"to"`
+	// Name the dependency is injected as
+	Alias string `json:"alias"`
+}
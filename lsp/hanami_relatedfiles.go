@@ -0,0 +1,25 @@
+package lsp
+
+/**
+ * hanami/relatedFiles is a custom request returning the action, view and
+ * templates related to a document.
+ */
+type RelatedFilesRequest struct {
+	Request
+	Params RelatedFilesParams `json:"params"`
+}
+
+type RelatedFilesParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type RelatedFilesResponse struct {
+	Response
+	Result []RelatedFile `json:"result"`
+}
+
+type RelatedFile struct {
+	// One of "action", "view" or "template"
+	Kind string `json:"kind"`
+	Location
+}
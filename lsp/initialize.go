@@ -1,5 +1,7 @@
 package lsp
 
+import "encoding/json"
+
 type InitializeRequest struct {
 	Request
 	Params InitializeRequestParams `json:"params"`
@@ -8,8 +10,11 @@ type InitializeRequest struct {
 type DocumentURI string
 
 type InitializeRequestParams struct {
-	ClientInfo *ClientInfo `json:"clientInfo"`
-	RootURI    DocumentURI `json:"rootUri,omitempty"`
+	ProcessID             *int               `json:"processId"`
+	ClientInfo            *ClientInfo        `json:"clientInfo"`
+	Capabilities          ClientCapabilities `json:"capabilities"`
+	RootURI               DocumentURI        `json:"rootUri,omitempty"`
+	InitializationOptions json.RawMessage    `json:"initializationOptions,omitempty"`
 }
 
 type ClientInfo struct {
@@ -27,10 +32,52 @@ type InitializeResult struct {
 	ServerInfo   ServerInfo         `json:"serverInfo"`
 }
 
+// ClientCapabilities is the subset of the client's capabilities the server
+// acts on.
+type ClientCapabilities struct {
+	Workspace WorkspaceClientCapabilities `json:"workspace"`
+}
+
+type WorkspaceClientCapabilities struct {
+	Configuration          bool                            `json:"configuration"`
+	DidChangeConfiguration DynamicRegistrationCapability   `json:"didChangeConfiguration"`
+	DidChangeWatchedFiles  DynamicRegistrationCapability   `json:"didChangeWatchedFiles"`
+	WorkspaceEdit          WorkspaceEditClientCapabilities `json:"workspaceEdit"`
+}
+
+type WorkspaceEditClientCapabilities struct {
+	DocumentChanges bool `json:"documentChanges"`
+	// Kinds of resource operations the client applies, e.g. "rename"
+	ResourceOperations []string `json:"resourceOperations"`
+}
+
+type DynamicRegistrationCapability struct {
+	DynamicRegistration bool `json:"dynamicRegistration"`
+}
+
 type ServerCapabilities struct {
-	TextDocumentSync int `json:"textDocumentSync"`
+	TextDocumentSync TextDocumentSyncOptions `json:"textDocumentSync"`
+
+	DefinitionProvider      bool               `json:"definitionProvider"`
+	CompletionProvider      *CompletionOptions `json:"completionProvider,omitempty"`
+	ReferencesProvider      bool               `json:"referencesProvider"`
+	RenameProvider          *RenameOptions     `json:"renameProvider,omitempty"`
+	HoverProvider           bool               `json:"hoverProvider"`
+	ImplementationProvider  bool               `json:"implementationProvider"`
+	DocumentSymbolProvider  bool               `json:"documentSymbolProvider"`
+	WorkspaceSymbolProvider bool               `json:"workspaceSymbolProvider"`
+	CallHierarchyProvider   bool               `json:"callHierarchyProvider"`
+}
+
+type TextDocumentSyncOptions struct {
+	OpenClose bool `json:"openClose"`
+	// 1 sends whole documents on change, 2 only the changed ranges
+	Change int          `json:"change"`
+	Save   *SaveOptions `json:"save,omitempty"`
+}
 
-	DefinitionProvider bool `json:"definitionProvider"`
+type SaveOptions struct {
+	IncludeText bool `json:"includeText"`
 }
 
 type ServerInfo struct {
@@ -38,7 +85,7 @@ type ServerInfo struct {
 	Version string `json:"version"`
 }
 
-func NewInitializeResponse(id *int) InitializeResponse {
+func NewInitializeResponse(id *ID) InitializeResponse {
 	return InitializeResponse{
 		Response: Response{
 			RPC: "2.0",
@@ -46,8 +93,24 @@ func NewInitializeResponse(id *int) InitializeResponse {
 		},
 		Result: InitializeResult{
 			Capabilities: ServerCapabilities{
-				TextDocumentSync:   1,
+				TextDocumentSync: TextDocumentSyncOptions{
+					OpenClose: true,
+					Change:    2,
+					Save:      &SaveOptions{},
+				},
 				DefinitionProvider: true,
+				CompletionProvider: &CompletionOptions{
+					TriggerCharacters: []string{"\"", "."},
+				},
+				ReferencesProvider: true,
+				RenameProvider: &RenameOptions{
+					PrepareProvider: true,
+				},
+				HoverProvider:           true,
+				ImplementationProvider:  true,
+				DocumentSymbolProvider:  true,
+				WorkspaceSymbolProvider: true,
+				CallHierarchyProvider:   true,
 			},
 			ServerInfo: ServerInfo{
 				Name:    "hanamilsp",
@@ -0,0 +1,13 @@
+package lsp
+
+type InitializedNotification struct {
+	Notification
+}
+
+type ShutdownRequest struct {
+	Request
+}
+
+type ExitNotification struct {
+	Notification
+}
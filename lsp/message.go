@@ -1,8 +1,58 @@
 package lsp
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ID identifies a request. JSON-RPC allows both integers and strings, so it
+// holds the id as JSON, which responses echo back unchanged.
+type ID string
+
+// IntID returns the id for the integer n.
+func IntID(n int) ID {
+	return ID(strconv.Itoa(n))
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	if id == "" {
+		return []byte("null"), nil
+	}
+
+	return []byte(id), nil
+}
+
+// UnmarshalJSON accepts an integer or a string, and leaves id unchanged for
+// null.
+func (id *ID) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if string(b) == "null" {
+		return nil
+	}
+
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		normalized, _ := json.Marshal(s)
+		*id = ID(normalized)
+		return nil
+	}
+
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request id %s, expected an integer or a string", b)
+	}
+	*id = ID(strconv.FormatInt(n, 10))
+	return nil
+}
+
 type Request struct {
 	RPC    string `json:"jsonrpc"`
-	ID     int    `json:"id"`
+	ID     ID     `json:"id"`
 	Method string `json:"method"`
 
 	// We will just specify the type of the params in all the Request types
@@ -11,7 +61,7 @@ type Request struct {
 
 type Response struct {
 	RPC string `json:"jsonrpc"`
-	ID  *int   `json:"id,omitempty"`
+	ID  *ID    `json:"id"`
 
 	// Result
 	// Error
@@ -27,3 +77,55 @@ type Notification struct {
 
 func (n Notification) ResponseMarker() {
 }
+
+// Error codes defined by JSON-RPC and the LSP specification
+const (
+	ParseError           = -32700
+	InvalidRequest       = -32600
+	MethodNotFound       = -32601
+	InvalidParams        = -32602
+	InternalError        = -32603
+	ServerNotInitialized = -32002
+	UnknownErrorCode     = -32001
+	RequestFailed        = -32803
+	ServerCancelled      = -32802
+	ContentModified      = -32801
+	RequestCancelled     = -32800
+)
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type ErrorResponse struct {
+	Response
+	Error ResponseError `json:"error"`
+}
+
+func NewErrorResponse(id *ID, err ResponseError) ErrorResponse {
+	return ErrorResponse{
+		Response: Response{
+			RPC: "2.0",
+			ID:  id,
+		},
+		Error: err,
+	}
+}
+
+// NullResponse is a successful response without a result, e.g. when no
+// definition could be found.
+type NullResponse struct {
+	Response
+	Result any `json:"result"`
+}
+
+func NewNullResponse(id *ID) NullResponse {
+	return NullResponse{
+		Response: Response{
+			RPC: "2.0",
+			ID:  id,
+		},
+	}
+}
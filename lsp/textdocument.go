@@ -51,8 +51,45 @@ type Range struct {
 	Start Position `json:"start"`
 	End   Position `json:"end"`
 }
+
 type WorkspaceEdit struct {
-	Changes map[string][]TextEdit `json:"changes"`
+	Changes map[string][]TextEdit `json:"changes,omitempty"`
+
+	/**
+	 * Either TextDocumentEdit or resource operations like RenameFile,
+	 * applied in order.
+	 */
+	DocumentChanges []any `json:"documentChanges,omitempty"`
+}
+
+type OptionalVersionedTextDocumentIdentifier struct {
+	TextDocumentIdentifier
+	Version *int `json:"version"`
+}
+
+type TextDocumentEdit struct {
+	TextDocument OptionalVersionedTextDocumentIdentifier `json:"textDocument"`
+	Edits        []TextEdit                              `json:"edits"`
+}
+
+type RenameFile struct {
+	Kind    string             `json:"kind"`
+	OldURI  string             `json:"oldUri"`
+	NewURI  string             `json:"newUri"`
+	Options *RenameFileOptions `json:"options,omitempty"`
+}
+
+type RenameFileOptions struct {
+	Overwrite      bool `json:"overwrite,omitempty"`
+	IgnoreIfExists bool `json:"ignoreIfExists,omitempty"`
+}
+
+func NewRenameFile(oldURI, newURI string) RenameFile {
+	return RenameFile{
+		Kind:   "rename",
+		OldURI: oldURI,
+		NewURI: newURI,
+	}
 }
 
 type TextEdit struct {
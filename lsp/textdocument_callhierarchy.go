@@ -0,0 +1,62 @@
+package lsp
+
+type CallHierarchyPrepareRequest struct {
+	Request
+	Params CallHierarchyPrepareParams `json:"params"`
+}
+
+type CallHierarchyPrepareParams struct {
+	TextDocumentPositionParams
+}
+
+type CallHierarchyPrepareResponse struct {
+	Response
+	Result []CallHierarchyItem `json:"result"`
+}
+
+type CallHierarchyItem struct {
+	Name   string `json:"name"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+	URI    string `json:"uri"`
+	// Range of the whole declaration
+	Range Range `json:"range"`
+	// Range of the name, shown when the item is picked
+	SelectionRange Range `json:"selectionRange"`
+}
+
+type CallHierarchyIncomingCallsRequest struct {
+	Request
+	Params CallHierarchyCallsParams `json:"params"`
+}
+
+type CallHierarchyOutgoingCallsRequest struct {
+	Request
+	Params CallHierarchyCallsParams `json:"params"`
+}
+
+type CallHierarchyCallsParams struct {
+	Item CallHierarchyItem `json:"item"`
+}
+
+type CallHierarchyIncomingCallsResponse struct {
+	Response
+	Result []CallHierarchyIncomingCall `json:"result"`
+}
+
+type CallHierarchyIncomingCall struct {
+	From CallHierarchyItem `json:"from"`
+	// Ranges of the calls, in the file of From
+	FromRanges []Range `json:"fromRanges"`
+}
+
+type CallHierarchyOutgoingCallsResponse struct {
+	Response
+	Result []CallHierarchyOutgoingCall `json:"result"`
+}
+
+type CallHierarchyOutgoingCall struct {
+	To CallHierarchyItem `json:"to"`
+	// Ranges of the calls, in the file of the item the request was made for
+	FromRanges []Range `json:"fromRanges"`
+}
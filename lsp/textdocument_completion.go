@@ -14,8 +14,19 @@ type CompletionResponse struct {
 	Result []CompletionItem `json:"result"`
 }
 
+const (
+	CompletionItemKindClass  = 7
+	CompletionItemKindModule = 9
+)
+
 type CompletionItem struct {
-	Label         string `json:"label"`
-	Detail        string `json:"detail"`
-	Documentation string `json:"documentation"`
+	Label         string    `json:"label"`
+	Kind          int       `json:"kind,omitempty"`
+	Detail        string    `json:"detail"`
+	Documentation string    `json:"documentation"`
+	TextEdit      *TextEdit `json:"textEdit,omitempty"`
+}
+
+type CompletionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters,omitempty"`
 }
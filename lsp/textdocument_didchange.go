@@ -15,6 +15,10 @@ type DidChangeTextDocumentParams struct {
  * it is considered to be the full content of the document.
  */
 type TextDocumentContentChangeEvent struct {
-	// The new text of the whole document.
+	// The range of the document that changed, nil if Text is the whole
+	// document.
+	Range *Range `json:"range,omitempty"`
+
+	// The new text for the range, or of the whole document.
 	Text string `json:"text"`
 }
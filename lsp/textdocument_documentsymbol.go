@@ -0,0 +1,37 @@
+package lsp
+
+type DocumentSymbolRequest struct {
+	Request
+	Params DocumentSymbolParams `json:"params"`
+}
+
+type DocumentSymbolParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentSymbolResponse struct {
+	Response
+	Result []DocumentSymbol `json:"result"`
+}
+
+const (
+	SymbolKindModule   = 2
+	SymbolKindClass    = 5
+	SymbolKindMethod   = 6
+	SymbolKindProperty = 7
+	SymbolKindField    = 8
+	SymbolKindFunction = 12
+	SymbolKindKey      = 20
+	SymbolKindStruct   = 23
+)
+
+type DocumentSymbol struct {
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+	Kind   int    `json:"kind"`
+	// Range of the whole declaration, used to nest symbols
+	Range Range `json:"range"`
+	// Range of the name, shown when the symbol is picked
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
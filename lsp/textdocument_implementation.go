@@ -0,0 +1,15 @@
+package lsp
+
+type ImplementationRequest struct {
+	Request
+	Params ImplementationParams `json:"params"`
+}
+
+type ImplementationParams struct {
+	TextDocumentPositionParams
+}
+
+type ImplementationResponse struct {
+	Response
+	Result []Location `json:"result"`
+}
@@ -0,0 +1,15 @@
+package lsp
+
+import "encoding/json"
+
+type ConfigurationParams struct {
+	Items []ConfigurationItem `json:"items"`
+}
+
+type ConfigurationItem struct {
+	ScopeURI string `json:"scopeUri,omitempty"`
+	Section  string `json:"section,omitempty"`
+}
+
+// ConfigurationResult holds one setting per requested item, in order.
+type ConfigurationResult []json.RawMessage
@@ -0,0 +1,14 @@
+package lsp
+
+import "encoding/json"
+
+type DidChangeConfigurationNotification struct {
+	Notification
+	Params DidChangeConfigurationParams `json:"params"`
+}
+
+type DidChangeConfigurationParams struct {
+	// All of the client's settings, or null when the server should pull the
+	// sections it needs with `workspace/configuration`
+	Settings json.RawMessage `json:"settings"`
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"hanamilsp/analysis"
 	"hanamilsp/lsp"
@@ -12,154 +12,559 @@ import (
 	"io"
 	"log"
 	"os"
-	"regexp"
+	"slices"
 	"strings"
-
-	sitter "github.com/smacker/go-tree-sitter"
-	"github.com/smacker/go-tree-sitter/ruby"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 func main() {
-	logger := getLogger("out.log")
+	listen := flag.String("listen", "", "serve editors over `tcp://host:port` or `unix:///path` instead of stdin and stdout")
+	flag.Parse()
+
+	if flag.Arg(0) == "graph" {
+		os.Exit(runGraph(flag.Args()[1:], os.Stdout, os.Stderr))
+	}
+
+	logger := getLogger(defaultLogPath)
 	logger.Println("Started hanamilsp...")
 
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Split(rpc.Split)
+	if *listen != "" {
+		if err := listenAndServe(logger, *listen); err != nil {
+			logger.Printf("error: %s", err)
+			fmt.Fprintf(os.Stderr, "hanamilsp: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	state := analysis.NewState(
 		logger,
 	)
-	writer := os.Stdout
-
-	handler := NewHandler(logger, writer, state)
+	conn := rpc.NewConn(os.Stdin, os.Stdout)
 
-	for scanner.Scan() {
-		msg := scanner.Bytes()
-		method, contents, err := rpc.DecodeMessage(msg)
-		if err != nil {
-			logger.Printf("Got an error: %s", err)
-			continue
-		}
+	handler := NewHandler(logger, conn, state)
+	handler.Serve()
 
-		handler.handleMessage(method, contents)
-	}
+	logger.Println("stdin closed, exiting")
+	handler.handleExit()
 }
 
 type MsgMethod string
 
 const (
-	INITIALIZE                        = "initialize"
-	TEXT_DOCUMENT_DID_OPEN            = "textDocument/didOpen"
-	TEXT_DOCUMENT_DID_CHANGE          = "textDocument/didChange"
-	TEXT_DOCUMENT_DEFINITION          = "textDocument/definition"
-	TEXT_DOCUMENT_PUBLISH_DIAGNOSTICS = "textDocument/publishDiagnostics"
+	INITIALIZE                           = "initialize"
+	INITIALIZED                          = "initialized"
+	SHUTDOWN                             = "shutdown"
+	EXIT                                 = "exit"
+	TEXT_DOCUMENT_DID_OPEN               = "textDocument/didOpen"
+	TEXT_DOCUMENT_DID_CHANGE             = "textDocument/didChange"
+	TEXT_DOCUMENT_DID_CLOSE              = "textDocument/didClose"
+	TEXT_DOCUMENT_DID_SAVE               = "textDocument/didSave"
+	TEXT_DOCUMENT_DEFINITION             = "textDocument/definition"
+	TEXT_DOCUMENT_COMPLETION             = "textDocument/completion"
+	TEXT_DOCUMENT_REFERENCES             = "textDocument/references"
+	TEXT_DOCUMENT_PREPARE_RENAME         = "textDocument/prepareRename"
+	TEXT_DOCUMENT_RENAME                 = "textDocument/rename"
+	TEXT_DOCUMENT_HOVER                  = "textDocument/hover"
+	TEXT_DOCUMENT_IMPLEMENTATION         = "textDocument/implementation"
+	TEXT_DOCUMENT_DOCUMENT_SYMBOL        = "textDocument/documentSymbol"
+	WORKSPACE_SYMBOL                     = "workspace/symbol"
+	TEXT_DOCUMENT_PREPARE_CALL_HIERARCHY = "textDocument/prepareCallHierarchy"
+	CALL_HIERARCHY_INCOMING_CALLS        = "callHierarchy/incomingCalls"
+	CALL_HIERARCHY_OUTGOING_CALLS        = "callHierarchy/outgoingCalls"
+	HANAMI_RELATED_FILES                 = "hanami/relatedFiles"
+	HANAMI_DEPENDENCY_GRAPH              = "hanami/dependencyGraph"
+	TEXT_DOCUMENT_PUBLISH_DIAGNOSTICS    = "textDocument/publishDiagnostics"
+	CANCEL_REQUEST                       = "$/cancelRequest"
+	WORKSPACE_DID_CHANGE_WATCHED_FILES   = "workspace/didChangeWatchedFiles"
 )
 
 type Handler struct {
 	Logger *log.Logger
-	Writer io.Writer
+	Conn   *rpc.Conn
 	State  *analysis.State
+
+	initialized        bool
+	shuttingDown       bool
+	clientCapabilities lsp.ClientCapabilities
+	// Sent by the client on initialize, the settings it sends later apply on
+	// top of them
+	initializationOptions json.RawMessage
+	// Called with the process exit code on `exit`, os.Exit by default
+	exit func(code int)
+	// Set when Logger is shared with other connections, whose log settings
+	// would otherwise override each other
+	sharedLogger bool
+	// Set when the client talks over stdio, and so started this process.
+	// The processId sent by clients of a listener may be on another host or
+	// in another pid namespace
+	watchParent bool
+
+	// Map of in-flight request ids to the cancel func of their context
+	requests   map[lsp.ID]context.CancelFunc
+	requestsMu sync.Mutex
+	inflight   sync.WaitGroup
+
+	// Held for reading while State.Index is in use, and for writing when it
+	// is replaced after files changed on disk
+	indexMu sync.RWMutex
+	// Serializes replacing the index and the config, neither of which is
+	// done on the read loop since it waits for requests holding indexMu
+	reindexMu sync.Mutex
+	// Number of configs received, and of the last one applied, guarded by
+	// reindexMu
+	configSeq        atomic.Uint64
+	appliedConfigSeq uint64
+	// Work started by the server itself: requests to the client, indexing and
+	// diagnostics
+	background sync.WaitGroup
+	// Held while diagnostics are published, so that those of a document that
+	// changed or closed in the meantime are dropped
+	diagnosticsMu sync.Mutex
+	// Cancelled once Serve returns, stopping work that lasts as long as the
+	// connection
+	serving     context.Context
+	stopServing context.CancelFunc
 }
 
 func NewHandler(
 	logger *log.Logger,
-	writer io.Writer,
+	conn *rpc.Conn,
 	state *analysis.State,
 ) *Handler {
+	serving, stopServing := context.WithCancel(context.Background())
 	return &Handler{
-		Logger: logger,
-		Writer: writer,
-		State:  state,
+		Logger:      logger,
+		Conn:        conn,
+		State:       state,
+		exit:        os.Exit,
+		requests:    map[lsp.ID]context.CancelFunc{},
+		serving:     serving,
+		stopServing: stopServing,
 	}
 }
 
 func NewDefaultHandler() *Handler {
-	logger := getLogger("out.log")
+	logger := getLogger(defaultLogPath)
 	state := analysis.NewState(
 		logger,
 	)
-	writer := os.Stdout
-	handler := NewHandler(logger, writer, state)
+	conn := rpc.NewConn(os.Stdin, os.Stdout)
+	handler := NewHandler(logger, conn, state)
+	handler.watchParent = true
 	return handler
 }
 
+// Serve handles every message read from Conn until it is closed, then waits
+// for in-flight requests to be answered and background work to finish.
+func (h *Handler) Serve() {
+	for {
+		method, contents, err := h.Conn.Read()
+		if errors.Is(err, rpc.ErrInvalidMessage) {
+			h.Logger.Printf("Got an error: %s", err)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				h.Logger.Printf("error: unable to read message, err: %s", err)
+			}
+			break
+		}
+
+		h.handleMessage(method, contents)
+	}
+
+	h.stopServing()
+	h.inflight.Wait()
+	h.background.Wait()
+}
+
 func (h *Handler) handleMessage(method string, contents []byte) {
 	h.Logger.Printf("received msg with method: %s", method)
 
+	if method == EXIT {
+		h.handleExit()
+		return
+	}
+
+	if _, err := parseRequestID(contents); err != nil {
+		h.Logger.Printf("error: invalid request id for method '%s', err: %s", method, err)
+		h.writeResponse(lsp.NewErrorResponse(nil, responseErrorFor(ErrorInvalidRequest{method: method, err: err})))
+		return
+	}
+
+	if h.shuttingDown {
+		if id := requestID(contents); id != nil {
+			h.writeError(id, ErrorShuttingDown{method: method})
+		}
+		return
+	}
+
+	if !h.initialized && method != INITIALIZE {
+		if id := requestID(contents); id != nil {
+			h.writeError(id, ErrorServerNotInitialized{method: method})
+		}
+		return
+	}
+
+	// Lifecycle messages and document notifications run in order on the read
+	// loop, so documents are always mutated in the order the client sent the
+	// changes. Requests run concurrently and may be cancelled.
 	switch method {
 	case INITIALIZE:
-		handle(h, method, contents, h.handleInitializeRequest)
+		handle(context.Background(), h, method, contents, h.handleInitializeRequest)
+	case INITIALIZED:
+		h.Logger.Println("client initialized")
+		h.registerCapabilities()
+		h.pullConfig()
+	case SHUTDOWN:
+		// Requests are refused from now on, but the cancelled ones are waited
+		// for off the read loop, which may have to deliver the responses to
+		// requests they sent to the client
+		h.shuttingDown = true
+		h.background.Add(1)
+		go func() {
+			defer h.background.Done()
+			handle(context.Background(), h, method, contents, h.handleShutdownRequest)
+		}()
+	case CANCEL_REQUEST:
+		h.handleCancelRequest(contents)
+	case WORKSPACE_DID_CHANGE_CONFIGURATION:
+		h.handleDidChangeConfiguration(contents)
+	case WORKSPACE_DID_CHANGE_WATCHED_FILES:
+		h.handleDidChangeWatchedFiles(contents)
 	case TEXT_DOCUMENT_DID_OPEN:
-		handle(h, method, contents, h.handleTextDocumentDidOpen)
+		h.handleTextDocumentDidOpen(contents)
 	case TEXT_DOCUMENT_DID_CHANGE:
-		handleSlice(h, method, contents, h.handleTextDocumentDidChange)
+		h.handleTextDocumentDidChange(contents)
+	case TEXT_DOCUMENT_DID_CLOSE:
+		handle(context.Background(), h, method, contents, h.handleTextDocumentDidClose)
+	case TEXT_DOCUMENT_DID_SAVE:
+		h.handleTextDocumentDidSave(contents)
 	case TEXT_DOCUMENT_DEFINITION:
-		handle(h, method, contents, h.handleTextDocumentDefinition)
+		handleAsync(h, method, contents, h.handleTextDocumentDefinition)
+	case TEXT_DOCUMENT_COMPLETION:
+		handleAsync(h, method, contents, h.handleTextDocumentCompletion)
+	case TEXT_DOCUMENT_REFERENCES:
+		handleAsync(h, method, contents, h.handleTextDocumentReferences)
+	case TEXT_DOCUMENT_PREPARE_RENAME:
+		handleAsync(h, method, contents, h.handleTextDocumentPrepareRename)
+	case TEXT_DOCUMENT_RENAME:
+		handleAsync(h, method, contents, h.handleTextDocumentRename)
+	case TEXT_DOCUMENT_HOVER:
+		handleAsync(h, method, contents, h.handleTextDocumentHover)
+	case TEXT_DOCUMENT_IMPLEMENTATION:
+		handleAsync(h, method, contents, h.handleTextDocumentImplementation)
+	case TEXT_DOCUMENT_DOCUMENT_SYMBOL:
+		handleAsync(h, method, contents, h.handleTextDocumentDocumentSymbol)
+	case WORKSPACE_SYMBOL:
+		handleAsync(h, method, contents, h.handleWorkspaceSymbol)
+	case TEXT_DOCUMENT_PREPARE_CALL_HIERARCHY:
+		handleAsync(h, method, contents, h.handleTextDocumentPrepareCallHierarchy)
+	case CALL_HIERARCHY_INCOMING_CALLS:
+		handleAsync(h, method, contents, h.handleCallHierarchyIncomingCalls)
+	case CALL_HIERARCHY_OUTGOING_CALLS:
+		handleAsync(h, method, contents, h.handleCallHierarchyOutgoingCalls)
+	case HANAMI_RELATED_FILES:
+		handleAsync(h, method, contents, h.handleHanamiRelatedFiles)
+	case HANAMI_DEPENDENCY_GRAPH:
+		handleAsync(h, method, contents, h.handleHanamiDependencyGraph)
+	default:
+		if id := requestID(contents); id != nil {
+			h.writeError(id, ErrorMethodNotFound{method: method})
+		}
 	}
 }
 
 func handle[T any, R ResponseConstraint](
+	ctx context.Context,
 	h *Handler,
 	method string,
 	contents []byte,
-	handlerFunc func(T) (R, error),
+	handlerFunc func(context.Context, T) (R, error),
 ) {
+	id := requestID(contents)
+
 	var v T
 	if err := json.Unmarshal(contents, &v); err != nil {
 		h.Logger.Printf("error: unable to unmarshal message for method '%s', err: %s", method, err)
+		h.writeError(id, ErrorInvalidParams{method: method, err: err})
 		return
 	}
 
-	msg, err := handlerFunc(v)
+	msg, err := handlerFunc(ctx, v)
+	// Handlers that finished regardless of the cancellation still answer
+	// with their result
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		h.Logger.Printf("cancelled request for method: %s", method)
+		h.writeError(id, ErrorRequestCancelled{method: method})
+		return
+	}
 	if err != nil {
 		h.Logger.Printf("error: got err back from handlerFunc for method: %s", method)
 		h.Logger.Printf("error: %s", err)
+		h.writeError(id, err)
 		return
 	}
 
-	writeResponse(h.Writer, msg)
-}
-
-type SliceConstraint[T any] interface {
-	~[]T
+	h.writeResponse(msg)
 }
 
-type ResponseConstraint interface {
-	ResponseMarker()
-}
-
-func handleSlice[T any, R ResponseConstraint, K SliceConstraint[R]](
+// handleAsync runs the request in its own goroutine, with a context that is
+// cancelled by `$/cancelRequest` or shutdown. Only handlers that give up with
+// the context's error are answered with RequestCancelled.
+func handleAsync[T any, R ResponseConstraint](
 	h *Handler,
 	method string,
 	contents []byte,
-	handlerFunc func(*T) K,
+	handlerFunc func(context.Context, T) (R, error),
 ) {
-	var v T
-	if err := json.Unmarshal(contents, &v); err != nil {
-		h.Logger.Printf("error: unable to unmarshal message for method '%s', err: %s", method, err)
+	ctx, done := h.startRequest(requestID(contents))
+
+	h.inflight.Add(1)
+	go func() {
+		defer h.inflight.Done()
+		defer done()
+		defer h.readIndex()()
+
+		handle(ctx, h, method, contents, handlerFunc)
+	}()
+}
+
+// startRequest tracks the request with the given id until the returned func
+// is called.
+func (h *Handler) startRequest(id *lsp.ID) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if id == nil {
+		return ctx, cancel
+	}
+
+	h.requestsMu.Lock()
+	h.requests[*id] = cancel
+	h.requestsMu.Unlock()
+
+	return ctx, func() {
+		h.requestsMu.Lock()
+		delete(h.requests, *id)
+		h.requestsMu.Unlock()
+		cancel()
+	}
+}
+
+func (h *Handler) handleCancelRequest(contents []byte) {
+	var notification lsp.CancelNotification
+	if err := json.Unmarshal(contents, &notification); err != nil {
+		h.Logger.Printf("error: unable to unmarshal message for method '%s', err: %s", CANCEL_REQUEST, err)
 		return
 	}
 
-	msg := handlerFunc(&v)
-	if msg == nil {
-		h.Logger.Printf("error: got nil back from handlerFunc for method: %s", method)
+	h.requestsMu.Lock()
+	cancel, ok := h.requests[notification.Params.ID]
+	h.requestsMu.Unlock()
+
+	// The request may already have been answered
+	if ok {
+		h.Logger.Printf("cancelling request %s", notification.Params.ID)
+		cancel()
+	}
+}
+
+func (h *Handler) handleDidChangeWatchedFiles(contents []byte) {
+	var notification lsp.DidChangeWatchedFilesNotification
+	if err := json.Unmarshal(contents, &notification); err != nil {
+		h.Logger.Printf("error: unable to unmarshal message for method '%s', err: %s", WORKSPACE_DID_CHANGE_WATCHED_FILES, err)
+		return
+	}
+
+	if len(notification.Params.Changes) == 0 {
 		return
 	}
 
-	for _, r := range msg {
-		writeResponse(h.Writer, r)
+	// Changed files are read again right away, the new index only replaces
+	// the table once it is built
+	for _, change := range notification.Params.Changes {
+		h.State.FileChanged(change.URI)
+	}
+
+	h.Logger.Printf("%d watched files changed, re-indexing", len(notification.Params.Changes))
+	h.reindexWorkspace(time.Now())
+}
+
+// cancelRequests cancels every in-flight request, without waiting for them
+// to be answered.
+func (h *Handler) cancelRequests() {
+	h.requestsMu.Lock()
+	for _, cancel := range h.requests {
+		cancel()
+	}
+	h.requestsMu.Unlock()
+}
+
+// requestID returns the id of the message, or nil for notifications and
+// messages whose id is invalid.
+func requestID(contents []byte) *lsp.ID {
+	id, _ := parseRequestID(contents)
+	return id
+}
+
+// parseRequestID returns the id of the message, nil for notifications, or an
+// error when the id is neither an integer nor a string.
+func parseRequestID(contents []byte) (*lsp.ID, error) {
+	var msg struct {
+		ID *lsp.ID `json:"id"`
+	}
+	if err := json.Unmarshal(contents, &msg); err != nil {
+		return nil, err
 	}
+
+	return msg.ID, nil
 }
 
-func (h *Handler) handleInitializeRequest(request lsp.InitializeRequest) (lsp.InitializeResponse, error) {
+// writeError answers the request with the given id with a JSON-RPC error
+// object, or with a null result for ErrorNoResult. Notifications are never
+// answered.
+func (h *Handler) writeError(id *lsp.ID, err error) {
+	if id == nil {
+		return
+	}
+
+	var noResult ErrorNoResult
+	if errors.As(err, &noResult) {
+		h.writeResponse(lsp.NewNullResponse(id))
+		return
+	}
+
+	h.writeResponse(lsp.NewErrorResponse(id, responseErrorFor(err)))
+}
+
+type ResponseConstraint interface {
+	ResponseMarker()
+}
+
+func (h *Handler) handleInitializeRequest(_ context.Context, request lsp.InitializeRequest) (lsp.InitializeResponse, error) {
 	h.State.RootURI = request.Params.RootURI
+	h.clientCapabilities = request.Params.Capabilities
+
+	h.initializationOptions = request.Params.InitializationOptions
+
+	config, err := analysis.ParseConfig(h.initializationOptions)
+	if err != nil {
+		h.Logger.Printf("error: unable to parse initializationOptions, err: %s", err)
+	}
+	h.configureLogging(config.Log)
+	h.State.Config = config
+
+	h.State.IndexWorkspace()
+	h.initialized = true
+
+	if request.Params.ProcessID != nil && h.watchParent {
+		go h.watchParentProcess(h.serving, *request.Params.ProcessID)
+	}
+
 	msg := lsp.NewInitializeResponse(&request.ID)
 	return msg, nil
 }
 
-func (h *Handler) handleTextDocumentDidOpen(request lsp.DidOpenTextDocumentNotification) (lsp.PublishDiagnosticsNotification, error) {
-	h.Logger.Printf("Opened: %s", request.Params.TextDocument.URI)
-	diagnostics := h.State.OpenDocument(request.Params.TextDocument.URI, request.Params.TextDocument.Text)
+func (h *Handler) handleShutdownRequest(_ context.Context, request lsp.ShutdownRequest) (lsp.NullResponse, error) {
+	h.Logger.Println("shutting down")
+	h.cancelRequests()
+	h.inflight.Wait()
+	return lsp.NewNullResponse(&request.ID), nil
+}
+
+// handleExit terminates the process, with status 0 only if a shutdown
+// request was received first.
+func (h *Handler) handleExit() {
+	code := 1
+	if h.shuttingDown {
+		code = 0
+	}
+
+	h.Logger.Printf("exiting with code %d", code)
+	h.flushLogs()
+	h.exit(code)
+}
+
+// watchParentProcess exits the server when the editor that started it dies
+// without sending shutdown and exit. It stops once ctx is done.
+func (h *Handler) watchParentProcess(ctx context.Context, pid int) {
+	ticker := time.NewTicker(parentProcessPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !processExists(pid) {
+				h.Logger.Printf("parent process %d is gone, exiting", pid)
+				h.flushLogs()
+				h.exit(1)
+				return
+			}
+		}
+	}
+}
+
+const parentProcessPollInterval = 3 * time.Second
+
+func (h *Handler) flushLogs() {
+	if out, ok := h.Logger.Writer().(*logOutput); ok {
+		out.Sync()
+	}
+}
+
+func (h *Handler) handleTextDocumentDidOpen(contents []byte) {
+	var notification lsp.DidOpenTextDocumentNotification
+	if err := json.Unmarshal(contents, &notification); err != nil {
+		h.Logger.Printf("error: unable to unmarshal message for method '%s', err: %s", TEXT_DOCUMENT_DID_OPEN, err)
+		return
+	}
+
+	document := notification.Params.TextDocument
+	h.Logger.Printf("Opened: %s", document.URI)
+	h.State.OpenDocument(document.URI, document.Version, document.Text)
+	h.publishDiagnostics(document.URI, document.Version)
+}
+
+func (h *Handler) handleTextDocumentDidChange(contents []byte) {
+	var notification lsp.TextDocumentDidChangeNotification
+	if err := json.Unmarshal(contents, &notification); err != nil {
+		h.Logger.Printf("error: unable to unmarshal message for method '%s', err: %s", TEXT_DOCUMENT_DID_CHANGE, err)
+		return
+	}
+
+	document := notification.Params.TextDocument
+	h.Logger.Printf("Changed: %s", document.URI)
+	h.State.UpdateDocument(document.URI, document.Version, notification.Params.ContentChanges)
+	h.publishDiagnostics(document.URI, document.Version)
+}
+
+// handleTextDocumentDidSave has the saved file read from disk rather than
+// from the index's table, once it is closed.
+func (h *Handler) handleTextDocumentDidSave(contents []byte) {
+	var notification lsp.DidSaveTextDocumentNotification
+	if err := json.Unmarshal(contents, &notification); err != nil {
+		h.Logger.Printf("error: unable to unmarshal message for method '%s', err: %s", TEXT_DOCUMENT_DID_SAVE, err)
+		return
+	}
+
+	h.Logger.Printf("Saved: %s", notification.Params.TextDocument.URI)
+	h.State.FileChanged(notification.Params.TextDocument.URI)
+}
+
+// handleTextDocumentDidClose drops the document and clears its diagnostics,
+// which are only kept up to date for open documents.
+func (h *Handler) handleTextDocumentDidClose(_ context.Context, request lsp.DidCloseTextDocumentNotification) (lsp.PublishDiagnosticsNotification, error) {
+	h.Logger.Printf("Closed: %s", request.Params.TextDocument.URI)
+
+	// Diagnostics published after this would never be cleared
+	h.diagnosticsMu.Lock()
+	h.State.CloseDocument(request.Params.TextDocument.URI)
+	h.diagnosticsMu.Unlock()
+
 	msg := lsp.PublishDiagnosticsNotification{
 		Notification: lsp.Notification{
 			RPC:    "2.0",
@@ -167,371 +572,332 @@ func (h *Handler) handleTextDocumentDidOpen(request lsp.DidOpenTextDocumentNotif
 		},
 		Params: lsp.PublishDiagnosticsParams{
 			URI:         request.Params.TextDocument.URI,
-			Diagnostics: diagnostics,
+			Diagnostics: []lsp.Diagnostic{},
 		},
 	}
 	return msg, nil
 }
 
-func (h *Handler) handleTextDocumentDidChange(request *lsp.TextDocumentDidChangeNotification) []lsp.PublishDiagnosticsNotification {
-	h.Logger.Printf("Changed: %s", request.Params.TextDocument.URI)
-	var notifications []lsp.PublishDiagnosticsNotification
-	for _, change := range request.Params.ContentChanges {
-		diagnostics := h.State.UpdateDocument(request.Params.TextDocument.URI, change.Text)
-		notifications = append(notifications, lsp.PublishDiagnosticsNotification{
-			Notification: lsp.Notification{
-				RPC:    "2.0",
-				Method: TEXT_DOCUMENT_PUBLISH_DIAGNOSTICS,
-			},
-			Params: lsp.PublishDiagnosticsParams{
-				URI:         request.Params.TextDocument.URI,
-				Diagnostics: diagnostics,
-			},
-		})
+func (h *Handler) handleTextDocumentCompletion(_ context.Context, request lsp.CompletionRequest) (lsp.CompletionResponse, error) {
+	uri := request.Params.TextDocument.URI
+	if _, ok := h.State.Document(uri); !ok {
+		return lsp.CompletionResponse{}, ErrorDocumentDoesNotExist{uri: uri}
 	}
 
-	return notifications
+	return h.State.TextDocumentCompletion(request.ID, uri, request.Params.Position), nil
 }
 
-type ErrorDocumentDoesNotExist struct {
-	uri string
+func (h *Handler) handleTextDocumentReferences(ctx context.Context, request lsp.ReferencesRequest) (lsp.ReferencesResponse, error) {
+	uri := request.Params.TextDocument.URI
+	if _, ok := h.State.Document(uri); !ok {
+		return lsp.ReferencesResponse{}, ErrorDocumentDoesNotExist{uri: uri}
+	}
+
+	return h.State.TextDocumentReferences(
+		ctx,
+		request.ID,
+		uri,
+		request.Params.Position,
+		request.Params.Context.IncludeDeclaration,
+	)
 }
 
-func (e ErrorDocumentDoesNotExist) Error() string {
-	return fmt.Sprintf("document does not exist in state, uri: %s", e.uri)
+func (h *Handler) handleTextDocumentPrepareRename(_ context.Context, request lsp.PrepareRenameRequest) (lsp.PrepareRenameResponse, error) {
+	uri := request.Params.TextDocument.URI
+	if _, ok := h.State.Document(uri); !ok {
+		return lsp.PrepareRenameResponse{}, ErrorDocumentDoesNotExist{uri: uri}
+	}
+
+	return h.State.TextDocumentPrepareRename(request.ID, uri, request.Params.Position), nil
 }
 
-type ErrorLineOutOfDocumentRange struct {
-	uri  string
-	line int
+func (h *Handler) handleTextDocumentRename(ctx context.Context, request lsp.RenameRequest) (lsp.RenameResponse, error) {
+	uri := request.Params.TextDocument.URI
+	if _, ok := h.State.Document(uri); !ok {
+		return lsp.RenameResponse{}, ErrorDocumentDoesNotExist{uri: uri}
+	}
+
+	// Renaming a component moves its file too, without it the key no longer
+	// resolves, so rename nothing rather than only the references
+	capabilities := h.clientCapabilities.Workspace.WorkspaceEdit
+	if !capabilities.DocumentChanges || !slices.Contains(capabilities.ResourceOperations, "rename") {
+		return lsp.RenameResponse{}, fmt.Errorf("renaming a component moves its file, which is %w", errClientUnsupported)
+	}
+
+	return h.State.TextDocumentRename(ctx, request.ID, uri, request.Params.Position, request.Params.NewName)
 }
 
-func (e ErrorLineOutOfDocumentRange) Error() string {
-	return fmt.Sprintf("line '%d' does not exist in document with uri: %s", e.line, e.uri)
+func (h *Handler) handleTextDocumentHover(_ context.Context, request lsp.HoverRequest) (lsp.HoverResponse, error) {
+	uri := request.Params.TextDocument.URI
+	if _, ok := h.State.Document(uri); !ok {
+		return lsp.HoverResponse{}, ErrorDocumentDoesNotExist{uri: uri}
+	}
+
+	return h.State.TextDocumentHover(request.ID, uri, request.Params.Position), nil
 }
 
-type ErrorCouldNotParseSymbolAndMethodName struct {
-	uri     string
-	line    int
-	rawLine string
+func (h *Handler) handleTextDocumentImplementation(_ context.Context, request lsp.ImplementationRequest) (lsp.ImplementationResponse, error) {
+	return h.State.TextDocumentImplementation(request.ID, request.Params.TextDocument.URI), nil
 }
 
-func (e ErrorCouldNotParseSymbolAndMethodName) Error() string {
-	return fmt.Sprintf("could not parse out line '%d' in document with uri: %s\nrawLine: %s", e.line, e.uri, e.rawLine)
+func (h *Handler) handleTextDocumentDocumentSymbol(_ context.Context, request lsp.DocumentSymbolRequest) (lsp.DocumentSymbolResponse, error) {
+	return h.State.TextDocumentDocumentSymbol(request.ID, request.Params.TextDocument.URI), nil
 }
 
-func (h *Handler) handleTextDocumentDefinition(request lsp.DefinitionRequest) (lsp.DefinitionResponse, error) {
+func (h *Handler) handleWorkspaceSymbol(_ context.Context, request lsp.WorkspaceSymbolRequest) (lsp.WorkspaceSymbolResponse, error) {
+	return h.State.WorkspaceSymbol(request.ID, request.Params.Query), nil
+}
+
+func (h *Handler) handleTextDocumentPrepareCallHierarchy(_ context.Context, request lsp.CallHierarchyPrepareRequest) (lsp.CallHierarchyPrepareResponse, error) {
 	uri := request.Params.TextDocument.URI
-	document, ok := h.State.Documents[uri]
-	if !ok {
-		return lsp.DefinitionResponse{}, ErrorDocumentDoesNotExist{uri: uri}
+	if _, ok := h.State.Document(uri); !ok {
+		return lsp.CallHierarchyPrepareResponse{}, ErrorDocumentDoesNotExist{uri: uri}
 	}
 
-	lines := strings.Split(document, "\n")
-	curLineNum := request.Params.Position.Line
-	if curLineNum > len(lines) {
-		return lsp.DefinitionResponse{}, ErrorLineOutOfDocumentRange{uri: uri, line: curLineNum}
-	}
-	currentLine := lines[curLineNum]
+	return h.State.TextDocumentPrepareCallHierarchy(request.ID, uri, request.Params.Position), nil
+}
 
-	symbolName, methodName := GetSymbolAndMethodNameToLookup(currentLine, request.Params.Position)
+func (h *Handler) handleCallHierarchyIncomingCalls(ctx context.Context, request lsp.CallHierarchyIncomingCallsRequest) (lsp.CallHierarchyIncomingCallsResponse, error) {
+	return h.State.CallHierarchyIncomingCalls(ctx, request.ID, request.Params.Item)
+}
 
-	h.Logger.Println("symbolName:", symbolName)
-	h.Logger.Println("methodName:", methodName)
+func (h *Handler) handleCallHierarchyOutgoingCalls(_ context.Context, request lsp.CallHierarchyOutgoingCallsRequest) (lsp.CallHierarchyOutgoingCallsResponse, error) {
+	return h.State.CallHierarchyOutgoingCalls(request.ID, request.Params.Item), nil
+}
 
-	if symbolName == "" {
-		symbolName = GetSymbolNameToLookup(currentLine, request.Params.Position)
-	}
+func (h *Handler) handleHanamiRelatedFiles(_ context.Context, request lsp.RelatedFilesRequest) (lsp.RelatedFilesResponse, error) {
+	return h.State.HanamiRelatedFiles(request.ID, request.Params.TextDocument.URI), nil
+}
 
-	if symbolName == "" && methodName == "" {
-		return lsp.DefinitionResponse{}, ErrorCouldNotParseSymbolAndMethodName{uri: uri, line: curLineNum}
-	}
+// RPCError is implemented by errors that map to a specific JSON-RPC error
+// code. Any other error is reported as RequestFailed.
+type RPCError interface {
+	error
+	Code() int
+	Data() any
+}
 
-	depsLine := GetIncludeDepsLine(document, symbolName)
-	h.Logger.Println("depsLineNum:", depsLine)
-	if depsLine == "" {
-		h.Logger.Println("depsLineNum == \"\"")
-		return lsp.DefinitionResponse{}, errors.New(fmt.Sprintf("no match found for '%s' in 'Deps' include list", symbolName))
+func responseErrorFor(err error) lsp.ResponseError {
+	var rpcErr RPCError
+	if errors.As(err, &rpcErr) {
+		return lsp.ResponseError{Code: rpcErr.Code(), Message: err.Error(), Data: rpcErr.Data()}
 	}
 
-	h.Logger.Printf("depsLine: %s", depsLine)
+	return lsp.ResponseError{Code: lsp.RequestFailed, Message: err.Error()}
+}
 
-	destinationURI, err := GetDefinitionURI(
-		depsLine,
-		uri,
-		string(h.State.RootURI),
-	)
+// ErrorNoResult means the request was valid but there is nothing to return,
+// e.g. no definition was found, and is answered with a null result.
+type ErrorNoResult struct {
+	reason string
+}
 
-	h.Logger.Println("destinationURI: ", destinationURI)
+func (e ErrorNoResult) Error() string {
+	return e.reason
+}
 
-	if err != nil {
-		h.Logger.Println("err: ", err)
-		return lsp.DefinitionResponse{}, err
-	}
+type ErrorMethodNotFound struct {
+	method string
+}
 
-	_, err = StatURI(destinationURI)
+func (e ErrorMethodNotFound) Error() string {
+	return fmt.Sprintf("method not found: %s", e.method)
+}
 
-	if err != nil {
-		h.Logger.Println("err: ", err)
-		return lsp.DefinitionResponse{}, err
-	}
+func (e ErrorMethodNotFound) Code() int { return lsp.MethodNotFound }
+func (e ErrorMethodNotFound) Data() any { return nil }
 
-	pos, err := GetPositionForMethodInFile(h.Logger, destinationURI, methodName)
-	h.Logger.Println("err GetLineNumForMethodInFile", err)
-	h.Logger.Println("pos:", pos)
+type ErrorInvalidRequest struct {
+	method string
+	err    error
+}
 
-	return lsp.DefinitionResponse{
-		Response: lsp.Response{
-			RPC: "2.0",
-			ID:  &request.ID,
-		},
-		Result: lsp.Location{
-			URI:   destinationURI,
-			Range: analysis.LineRange(pos.Line, pos.Character, pos.Character),
-		},
-	}, nil
+func (e ErrorInvalidRequest) Error() string {
+	return fmt.Sprintf("invalid request for method '%s': %s", e.method, e.err)
 }
 
-func GetIncludeDepsLine(document string, symbolName string) string {
-	parser := sitter.NewParser()
-	lang := ruby.GetLanguage()
-	parser.SetLanguage(lang)
+func (e ErrorInvalidRequest) Code() int { return lsp.InvalidRequest }
+func (e ErrorInvalidRequest) Data() any { return nil }
 
-	tree, _ := parser.ParseCtx(
-		context.Background(),
-		nil,
-		[]byte(document),
-	)
-	n := tree.RootNode()
-
-	p := fmt.Sprintf(`
-	(call
-	  method: (identifier) @n_include (#eq? @n_include "include")
-	  arguments: (argument_list
-		       (element_reference
-			 object: (constant) @n_deps (#eq? @n_deps "Deps")
-			 [(string (string_content) @n_dep (#match? @n_dep "%s"))
-			  (pair
-			    key: (hash_key_symbol) @k (#match? @k "%s")
-			    value: (string (string_content) @k_dep))])))
-	`, symbolName, symbolName)
-
-	q, _ := sitter.NewQuery([]byte(p), lang)
-	qc := sitter.NewQueryCursor()
-	qc.Exec(q, n)
-
-	var capturedNode *sitter.Node
+type ErrorShuttingDown struct {
+	method string
+}
 
-	for {
-		m, ok := qc.NextMatch()
-		if !ok {
-			break
-		}
+func (e ErrorShuttingDown) Error() string {
+	return fmt.Sprintf("received '%s' after shutdown", e.method)
+}
 
-		m = qc.FilterPredicates(m, []byte(document))
-		for _, c := range m.Captures {
-			if c.Index == 2 || c.Index == 4 {
-				capturedNode = c.Node
-			}
-		}
-	}
+func (e ErrorShuttingDown) Code() int { return lsp.InvalidRequest }
+func (e ErrorShuttingDown) Data() any { return nil }
 
-	if capturedNode == nil {
-		return ""
-	}
+type ErrorServerNotInitialized struct {
+	method string
+}
 
-	return capturedNode.Content([]byte(document))
+func (e ErrorServerNotInitialized) Error() string {
+	return fmt.Sprintf("received '%s' before initialize", e.method)
 }
 
-func GetSymbolNameToLookup(
-	line string,
-	position lsp.Position,
-) string {
-	parser := sitter.NewParser()
-	lang := ruby.GetLanguage()
-	parser.SetLanguage(lang)
+func (e ErrorServerNotInitialized) Code() int { return lsp.ServerNotInitialized }
+func (e ErrorServerNotInitialized) Data() any { return nil }
 
-	tree, _ := parser.ParseCtx(
-		context.Background(),
-		nil,
-		[]byte(line),
-	)
-	n := tree.RootNode()
+type ErrorRequestCancelled struct {
+	method string
+}
 
-	p := `(_) @node`
-	q, _ := sitter.NewQuery([]byte(p), lang)
-	qc := sitter.NewQueryCursor()
-	qc.Exec(q, n)
+func (e ErrorRequestCancelled) Error() string {
+	return fmt.Sprintf("request for method '%s' was cancelled", e.method)
+}
 
-	var mostSpecificNode *sitter.Node
-	var matchesInRange []*sitter.Node
-	for {
-		m, ok := qc.NextMatch()
-		if !ok {
-			break
-		}
-		// Apply predicates filtering
-		m = qc.FilterPredicates(m, []byte(line))
-		for _, c := range m.Captures {
-			r := c.Node.Range()
+func (e ErrorRequestCancelled) Code() int { return lsp.RequestCancelled }
+func (e ErrorRequestCancelled) Data() any { return nil }
 
-			sCol := r.StartPoint.Column
-			eCol := r.EndPoint.Column
+type ErrorInvalidParams struct {
+	method string
+	err    error
+}
 
-			if position.Character >= int(sCol) && position.Character <= int(eCol) {
-				matchesInRange = append(matchesInRange, c.Node)
-			}
-		}
-	}
+func (e ErrorInvalidParams) Error() string {
+	return fmt.Sprintf("invalid params for method '%s': %s", e.method, e.err)
+}
 
-	if matchesInRange == nil {
-		return ""
-	}
+func (e ErrorInvalidParams) Code() int { return lsp.InvalidParams }
+func (e ErrorInvalidParams) Data() any { return nil }
 
-	mostSpecificNode = matchesInRange[len(matchesInRange)-1]
-	return mostSpecificNode.Content([]byte(line))
+type ErrorDocumentDoesNotExist struct {
+	uri string
 }
 
-func GetSymbolAndMethodNameToLookup(
-	line string,
-	position lsp.Position,
-) (string, string) {
-	parser := sitter.NewParser()
-	lang := ruby.GetLanguage()
-	parser.SetLanguage(lang)
-
-	tree, _ := parser.ParseCtx(
-		context.Background(),
-		nil,
-		[]byte(line),
-	)
-	n := tree.RootNode()
+func (e ErrorDocumentDoesNotExist) Error() string {
+	return fmt.Sprintf("document does not exist in state, uri: %s", e.uri)
+}
 
-	p := `(call receiver: (identifier) @a method: (identifier) @b)`
-	q, _ := sitter.NewQuery([]byte(p), lang)
-	qc := sitter.NewQueryCursor()
-	qc.Exec(q, n)
+func (e ErrorDocumentDoesNotExist) Code() int { return lsp.InvalidParams }
+func (e ErrorDocumentDoesNotExist) Data() any { return map[string]any{"uri": e.uri} }
 
-	var sym, method string
-	for {
-		m, ok := qc.NextMatch()
-		if !ok {
-			break
-		}
-		// Apply predicates filtering
-		m = qc.FilterPredicates(m, []byte(line))
-		if len(m.Captures) != 2 {
-			return sym, method
-		}
+type ErrorLineOutOfDocumentRange struct {
+	uri  string
+	line int
+}
 
-		receiver := m.Captures[0].Node
-		rangeReceiver := receiver.Range()
+func (e ErrorLineOutOfDocumentRange) Error() string {
+	return fmt.Sprintf("line '%d' does not exist in document with uri: %s", e.line, e.uri)
+}
 
-		methodNode := m.Captures[1].Node
-		rangeMethod := methodNode.Range()
+func (e ErrorLineOutOfDocumentRange) Code() int { return lsp.InvalidParams }
+func (e ErrorLineOutOfDocumentRange) Data() any {
+	return map[string]any{"uri": e.uri, "line": e.line}
+}
 
-		if position.Character >= int(rangeReceiver.StartPoint.Column) && position.Character <= int(rangeMethod.EndPoint.Column) {
-			sym = receiver.Content([]byte(line))
-			method = methodNode.Content([]byte(line))
-		}
-	}
+type ErrorCouldNotParseSymbolAndMethodName struct {
+	uri     string
+	line    int
+	rawLine string
+}
 
-	return sym, method
+func (e ErrorCouldNotParseSymbolAndMethodName) Error() string {
+	return fmt.Sprintf("could not parse out line '%d' in document with uri: %s\nrawLine: %s", e.line, e.uri, e.rawLine)
 }
 
-func GetPositionForMethodInFile(logger *log.Logger, uri string, methodName string) (lsp.Position, error) {
-	var pos lsp.Position
+func (e ErrorCouldNotParseSymbolAndMethodName) Code() int { return lsp.RequestFailed }
+func (e ErrorCouldNotParseSymbolAndMethodName) Data() any {
+	return map[string]any{"uri": e.uri, "line": e.line}
+}
 
-	if methodName == "" {
-		return pos, nil
+func (h *Handler) handleTextDocumentDefinition(_ context.Context, request lsp.DefinitionRequest) (lsp.DefinitionResponse, error) {
+	uri := request.Params.TextDocument.URI
+	document, ok := h.State.Document(uri)
+	if !ok {
+		return lsp.DefinitionResponse{}, ErrorDocumentDoesNotExist{uri: uri}
 	}
 
-	documentText, err := os.ReadFile(strings.TrimPrefix(uri, "file://"))
-	if err != nil {
-		return pos, fmt.Errorf("error GetLineNumForMethodInFile: %w", err)
+	if location, ok := h.State.RouteDefinition(uri, request.Params.Position); ok {
+		return lsp.DefinitionResponse{
+			Response: lsp.Response{
+				RPC: "2.0",
+				ID:  &request.ID,
+			},
+			Result: location,
+		}, nil
 	}
 
-	parser := sitter.NewParser()
-	lang := ruby.GetLanguage()
-	parser.SetLanguage(lang)
+	curLineNum := request.Params.Position.Line
+	if curLineNum > strings.Count(document, "\n") {
+		return lsp.DefinitionResponse{}, ErrorLineOutOfDocumentRange{uri: uri, line: curLineNum}
+	}
 
-	tree, _ := parser.ParseCtx(
-		context.Background(),
-		nil,
-		[]byte(documentText),
-	)
-	n := tree.RootNode()
+	text, root, err := h.State.SyntaxTree(uri)
+	if err != nil {
+		return lsp.DefinitionResponse{}, err
+	}
 
-	p := fmt.Sprintf(`(method name: (identifier) @a (#match? @a ".*%s"))`, methodName)
-	q, _ := sitter.NewQuery([]byte(p), lang)
-	qc := sitter.NewQueryCursor()
-	qc.Exec(q, n)
+	var symbolName, methodName string
+	if call, ok := analysis.CallAt(root, text, request.Params.Position); ok {
+		symbolName, methodName = call.Receiver, call.Method
+	} else {
+		symbolName = analysis.SymbolAt(root, text, request.Params.Position)
+	}
 
-	for {
-		m, ok := qc.NextMatch()
-		if !ok {
-			break
-		}
-		// Apply predicates filtering
-		m = qc.FilterPredicates(m, []byte(documentText))
-		logger.Println("captures", m.Captures)
-		logger.Println("document", documentText)
-		logger.Println("p", p)
-		if len(m.Captures) != 1 {
-			return pos, errors.New(fmt.Sprintf("unable to resolve method with name '%s' in file '%s'", methodName, uri))
-		}
+	h.Logger.Println("symbolName:", symbolName)
+	h.Logger.Println("methodName:", methodName)
 
-		pos.Line = int(m.Captures[0].Node.Range().StartPoint.Row)
-		pos.Character = int(m.Captures[0].Node.Range().StartPoint.Column)
+	if symbolName == "" && methodName == "" {
+		return lsp.DefinitionResponse{}, ErrorCouldNotParseSymbolAndMethodName{uri: uri, line: curLineNum}
 	}
 
-	return pos, nil
-}
-
-var SliceNames = map[string]bool{
-	"domain":         true,
-	"collaborations": true,
-}
+	entries := analysis.DepsEntries(h.State.Queries, root, text)
+	entry, ok := analysis.DepsEntryAt(entries, request.Params.Position)
+	if !ok {
+		entry, ok = analysis.DepsEntryForAlias(entries, symbolName)
+	}
+	if !ok {
+		return lsp.DefinitionResponse{}, ErrorNoResult{reason: fmt.Sprintf("no match found for '%s' in 'Deps' include list", symbolName)}
+	}
 
-func GetDefinitionURI(currentLine string, currentURI string, rootURI string) (string, error) {
-	trimmedLine := strings.Trim(currentLine, " \",")
+	h.Logger.Printf("deps key: %s", entry.Key)
 
-	firstIden, rest, found := strings.Cut(trimmedLine, ".")
+	destinationURI, err := h.State.GetDefinitionURI(
+		entry.Key,
+		uri,
+		string(h.State.RootURI),
+	)
 
-	var sliceName string
-	if found && SliceNames[firstIden] {
-		trimmedLine = rest
-		sliceName = firstIden
-	} else {
-		re := regexp.MustCompile(rootURI + `/slices/(\w*)/`)
-		matches := re.FindStringSubmatch(currentURI)
-		if len(matches) < 2 {
-			return "", errors.New("unable to infer current slice name")
-		}
+	h.Logger.Println("destinationURI: ", destinationURI)
 
-		sliceName = re.FindStringSubmatch(currentURI)[1]
+	if err != nil {
+		h.Logger.Println("err: ", err)
+		return lsp.DefinitionResponse{}, ErrorNoResult{reason: err.Error()}
 	}
 
-	destURIExtension := strings.Replace(trimmedLine, ".", "/", -1) + ".rb"
+	_, err = analysis.StatURI(destinationURI)
 
-	return rootURI + "/slices/" + sliceName + "/" + destURIExtension, nil
-}
+	if err != nil {
+		h.Logger.Println("err: ", err)
+		return lsp.DefinitionResponse{}, ErrorNoResult{reason: err.Error()}
+	}
 
-func StatURI(input string) (os.FileInfo, error) {
-	filepath := strings.TrimPrefix(input, "file://")
-	return os.Stat(filepath)
-}
+	var pos lsp.Position
+	if methodName != "" {
+		if destination, destinationRoot, err := h.State.SyntaxTree(destinationURI); err == nil {
+			pos, _ = analysis.FindMethodDeclaration(h.State.Queries, destinationRoot, destination, methodName)
+		}
+	}
+	h.Logger.Println("pos:", pos)
 
-func writeResponse(writer io.Writer, msg any) {
-	reply := rpc.EncodeMessage(msg)
-	writer.Write([]byte(reply))
+	return lsp.DefinitionResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &request.ID,
+		},
+		Result: lsp.Location{
+			URI:   destinationURI,
+			Range: analysis.LineRange(pos.Line, pos.Character, pos.Character),
+		},
+	}, nil
 }
 
-func getLogger(filename string) *log.Logger {
-	logfile, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
-	if err != nil {
-		panic("hey, you didn't give me a good file")
+func (h *Handler) writeResponse(msg any) {
+	if err := h.Conn.Write(msg); err != nil {
+		h.Logger.Printf("error: unable to write response, err: %s", err)
 	}
-
-	return log.New(logfile, "[hanamilsp]", log.Ldate|log.Ltime|log.Lshortfile)
 }
@@ -1,106 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hanamilsp/analysis"
 	"hanamilsp/lsp"
+	"hanamilsp/rpc"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
 
-func TestGetSymbolNameToLookup(t *testing.T) {
-	is := is.New(t)
-
-	line := "           goal, key_results = transaction.call do"
-	position := lsp.Position{
-		Line:      91,
-		Character: 31,
-	}
-
-	is.Equal(GetSymbolNameToLookup(line, position), "transaction")
-}
-
-func TestGetSymbolAndMethodNameToLookup(t *testing.T) {
-	is := is.New(t)
-
-	testCases := []struct {
-		name           string
-		line           string
-		character      int
-		expectedSym    string
-		expectedMethod string
-	}{
-		{
-			name:           "basic",
-			line:           `goal_result = yield with_failure_prefix.call(prefix: "goal")`,
-			character:      41,
-			expectedSym:    "with_failure_prefix",
-			expectedMethod: "call",
-		},
-		{
-			name:           "basic",
-			line:           `updated_visibility = yield apply_visibility.call(`,
-			character:      42,
-			expectedSym:    "apply_visibility",
-			expectedMethod: "call",
-		},
-		{
-			name:           "sym and method not found",
-			line:           `"operations.with_failure_prefix"`,
-			character:      18,
-			expectedSym:    "",
-			expectedMethod: "",
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			position := lsp.Position{
-				Line:      0,
-				Character: tc.character,
-			}
-
-			sym, method := GetSymbolAndMethodNameToLookup(tc.line, position)
-			is.Equal(sym, tc.expectedSym)
-			is.Equal(method, tc.expectedMethod)
-		})
-	}
-}
-
-func TestGetIncludeDepsLine(t *testing.T) {
-	is := is.New(t)
-
-	b, err := os.ReadFile(filepath.Join("./testdata", "slices", "domain", "operations", "commands", "create_published_goal.rb"))
-	if err != nil {
-		t.Fatalf("could not read fixture file: %s", err)
-	}
-	document := string(b)
-
-	testCases := []struct {
-		symbolName   string
-		expectedLine int
-	}{
-		{
-			symbolName:   "transaction",
-			expectedLine: 5,
-		},
-		{
-			symbolName:   "create_key_result",
-			expectedLine: 9,
-		},
-		{
-			symbolName:   "get_collaboration", // doesn't exist
-			expectedLine: -1,
-		},
-	}
-
-	for _, tc := range testCases {
-		receivedLine := GetIncludeDepsLine(document, tc.symbolName)
-		is.Equal(receivedLine, tc.expectedLine)
-	}
-}
-
 func TestHandleInitializeRequest(t *testing.T) {
 	is := is.New(t)
 	h := NewDefaultHandler()
@@ -109,13 +28,13 @@ func TestHandleInitializeRequest(t *testing.T) {
 	req := lsp.InitializeRequest{
 		Request: lsp.Request{
 			RPC: "2.0",
-			ID:  1,
+			ID:  lsp.IntID(1),
 		},
 		Params: lsp.InitializeRequestParams{
 			RootURI: lsp.DocumentURI(testuri),
 		},
 	}
-	resp, err := h.handleInitializeRequest(req)
+	resp, err := h.handleInitializeRequest(context.Background(), req)
 
 	t.Run("it does not return an error", func(t *testing.T) {
 		is.NoErr(err)
@@ -124,8 +43,24 @@ func TestHandleInitializeRequest(t *testing.T) {
 	t.Run("it returns the correct result", func(t *testing.T) {
 		is.Equal(resp.Result, lsp.InitializeResult{
 			Capabilities: lsp.ServerCapabilities{
-				TextDocumentSync:   1,
+				TextDocumentSync: lsp.TextDocumentSyncOptions{
+					OpenClose: true,
+					Change:    2,
+					Save:      &lsp.SaveOptions{},
+				},
 				DefinitionProvider: true,
+				CompletionProvider: &lsp.CompletionOptions{
+					TriggerCharacters: []string{"\"", "."},
+				},
+				ReferencesProvider: true,
+				RenameProvider: &lsp.RenameOptions{
+					PrepareProvider: true,
+				},
+				HoverProvider:           true,
+				ImplementationProvider:  true,
+				DocumentSymbolProvider:  true,
+				WorkspaceSymbolProvider: true,
+				CallHierarchyProvider:   true,
 			},
 			ServerInfo: lsp.ServerInfo{
 				Name:    "hanamilsp",
@@ -281,7 +216,7 @@ func TestHandleTextDocumentDefinition(t *testing.T) {
 				withCurrentPosition(tc.CurrentPosition),
 			)
 
-			resp, err := h.handleTextDocumentDefinition(req)
+			resp, err := h.handleTextDocumentDefinition(context.Background(), req)
 			if err != nil {
 				is.Equal(err, tc.Err)
 			} else {
@@ -291,6 +226,387 @@ func TestHandleTextDocumentDefinition(t *testing.T) {
 	}
 }
 
+func TestHandleMessage(t *testing.T) {
+	is := is.New(t)
+
+	testCases := []struct {
+		Name     string
+		Method   string
+		Contents string
+		Expected string
+	}{
+		{
+			Name:     "it answers unknown requests with MethodNotFound",
+			Method:   "textDocument/unknown",
+			Contents: `{"jsonrpc":"2.0","id":2,"method":"textDocument/unknown","params":{}}`,
+			Expected: `{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method not found: textDocument/unknown"}}`,
+		},
+		{
+			Name:     "it answers requests with string ids",
+			Method:   "textDocument/unknown",
+			Contents: `{"jsonrpc":"2.0","id":"abc","method":"textDocument/unknown","params":{}}`,
+			Expected: `{"jsonrpc":"2.0","id":"abc","error":{"code":-32601,"message":"method not found: textDocument/unknown"}}`,
+		},
+		{
+			Name:     "it answers requests with invalid ids with InvalidRequest",
+			Method:   WORKSPACE_SYMBOL,
+			Contents: `{"jsonrpc":"2.0","id":{"a":1},"method":"workspace/symbol","params":{"query":"goal"}}`,
+			Expected: `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request for method 'workspace/symbol': invalid request id {\"a\":1}, expected an integer or a string"}}`,
+		},
+		{
+			Name:     "it ignores unknown notifications",
+			Method:   "$/unknown",
+			Contents: `{"jsonrpc":"2.0","method":"$/unknown","params":{}}`,
+		},
+		{
+			Name:     "it maps typed errors to error objects",
+			Method:   TEXT_DOCUMENT_DEFINITION,
+			Contents: `{"jsonrpc":"2.0","id":3,"method":"textDocument/definition","params":{"textDocument":{"uri":"baduri"},"position":{"line":0,"character":0}}}`,
+			Expected: `{"jsonrpc":"2.0","id":3,"error":{"code":-32602,"message":"document does not exist in state, uri: baduri","data":{"uri":"baduri"}}}`,
+		},
+		{
+			Name:     "it answers with a null result when no definition is found",
+			Method:   TEXT_DOCUMENT_DEFINITION,
+			Contents: `{"jsonrpc":"2.0","id":4,"method":"textDocument/definition","params":{"textDocument":{"uri":"file:///a.rb"},"position":{"line":0,"character":1}}}`,
+			Expected: `{"jsonrpc":"2.0","id":4,"result":null}`,
+		},
+		{
+			Name:     "it outlines documents",
+			Method:   TEXT_DOCUMENT_DOCUMENT_SYMBOL,
+			Contents: `{"jsonrpc":"2.0","id":6,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"file:///a.rb"}}}`,
+			Expected: `{"jsonrpc":"2.0","id":6,"result":[{"name":"bar","kind":6,"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":12}},"selectionRange":{"start":{"line":1,"character":4},"end":{"line":1,"character":7}}}]}`,
+		},
+		{
+			Name:     "it answers workspace symbol queries before the workspace is indexed",
+			Method:   WORKSPACE_SYMBOL,
+			Contents: `{"jsonrpc":"2.0","id":7,"method":"workspace/symbol","params":{"query":"goal"}}`,
+			Expected: `{"jsonrpc":"2.0","id":7,"result":[]}`,
+		},
+		{
+			Name:     "it prepares no call hierarchy outside a component",
+			Method:   TEXT_DOCUMENT_PREPARE_CALL_HIERARCHY,
+			Contents: `{"jsonrpc":"2.0","id":8,"method":"textDocument/prepareCallHierarchy","params":{"textDocument":{"uri":"file:///a.rb"},"position":{"line":0,"character":0}}}`,
+			Expected: `{"jsonrpc":"2.0","id":8,"result":null}`,
+		},
+		{
+			Name:     "it answers outgoing calls",
+			Method:   CALL_HIERARCHY_OUTGOING_CALLS,
+			Contents: `{"jsonrpc":"2.0","id":9,"method":"callHierarchy/outgoingCalls","params":{"item":{"name":"a","kind":5,"uri":"file:///a.rb","range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"selectionRange":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}}}}}`,
+			Expected: `{"jsonrpc":"2.0","id":9,"result":[]}`,
+		},
+		{
+			Name:     "it answers dependency graph requests before the workspace is indexed",
+			Method:   HANAMI_DEPENDENCY_GRAPH,
+			Contents: `{"jsonrpc":"2.0","id":10,"method":"hanami/dependencyGraph","params":{"format":"mermaid"}}`,
+			Expected: `{"jsonrpc":"2.0","id":10,"result":{"nodes":[],"edges":[],"content":"flowchart LR\n"}}`,
+		},
+		{
+			Name:     "it does not rename components when the client cannot rename files",
+			Method:   TEXT_DOCUMENT_RENAME,
+			Contents: `{"jsonrpc":"2.0","id":11,"method":"textDocument/rename","params":{"textDocument":{"uri":"file:///a.rb"},"position":{"line":0,"character":1},"newName":"baz"}}`,
+			Expected: `{"jsonrpc":"2.0","id":11,"error":{"code":-32803,"message":"renaming a component moves its file, which is not supported by the client"}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewTestBufferHandler(t, &buf)
+			h.State.Documents["file:///a.rb"] = "foo.bar\ndef bar; end\n"
+
+			h.handleMessage(tc.Method, []byte(tc.Contents))
+			h.inflight.Wait()
+
+			responses := ReadTestResponses(t, &buf)
+			if tc.Expected == "" {
+				is.Equal(len(responses), 0)
+				return
+			}
+
+			is.Equal(len(responses), 1)
+			is.Equal(responses[0], tc.Expected)
+		})
+	}
+
+	t.Run("it rejects invalid params", func(t *testing.T) {
+		var buf bytes.Buffer
+		h := NewTestBufferHandler(t, &buf)
+
+		h.handleMessage(TEXT_DOCUMENT_DEFINITION, []byte(`{"jsonrpc":"2.0","id":5,"method":"textDocument/definition","params":{"position":"nope"}}`))
+		h.inflight.Wait()
+
+		responses := ReadTestResponses(t, &buf)
+		is.Equal(len(responses), 1)
+		is.True(strings.HasPrefix(responses[0], `{"jsonrpc":"2.0","id":5,"error":{"code":-32602,"message":"invalid params for method 'textDocument/definition'`))
+	})
+
+	t.Run("it forgets closed documents", func(t *testing.T) {
+		var buf bytes.Buffer
+		h := NewTestBufferHandler(t, &buf)
+
+		h.handleMessage(TEXT_DOCUMENT_DID_OPEN, []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///b.rb","version":1,"text":"foo.bar\n"}}}`))
+		h.background.Wait()
+		h.handleMessage(TEXT_DOCUMENT_DID_CLOSE, []byte(`{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":"file:///b.rb"}}}`))
+
+		responses := ReadTestResponses(t, &buf)
+		is.Equal(len(responses), 2)
+		is.Equal(responses[1], `{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///b.rb","diagnostics":[]}}`)
+		_, open := h.State.Documents["file:///b.rb"]
+		is.True(!open)
+		_, parsed := h.State.Trees["file:///b.rb"]
+		is.True(!parsed)
+	})
+
+	t.Run("it rejects requests before initialize", func(t *testing.T) {
+		var buf bytes.Buffer
+		h := NewHandler(getLogger("out.log"), rpc.NewConn(bytes.NewReader(nil), &buf), analysis.NewState(getLogger("out.log")))
+
+		h.handleMessage(TEXT_DOCUMENT_HOVER, []byte(`{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":{}}`))
+
+		is.Equal(ReadTestResponses(t, &buf), []string{
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32002,"message":"received 'textDocument/hover' before initialize"}}`,
+		})
+	})
+}
+
+func TestServeLargeDocument(t *testing.T) {
+	is := is.New(t)
+
+	// Well over bufio.Scanner's default 64KB token limit
+	text := "class Foo\n  include Deps[\"operations.transaction\"]\n" + strings.Repeat("  # padding\n", 250_000) + "end\n"
+	didOpen, err := json.Marshal(lsp.DidOpenTextDocumentNotification{
+		Notification: lsp.Notification{RPC: "2.0", Method: TEXT_DOCUMENT_DID_OPEN},
+		Params: lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{URI: "file:///large.rb", Version: 1, Text: text},
+		},
+	})
+	is.NoErr(err)
+
+	input := rpc.EncodeMessage(json.RawMessage(didOpen)) +
+		rpc.EncodeMessage(json.RawMessage(`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`))
+
+	var buf bytes.Buffer
+	h := NewTestBufferHandler(t, &buf)
+	h.Conn = rpc.NewConn(strings.NewReader(input), &buf)
+
+	h.Serve()
+
+	document, ok := h.State.Document("file:///large.rb")
+	is.True(ok)
+	is.Equal(len(document), len(text))
+
+	responses := ReadTestResponses(t, &buf)
+	is.Equal(len(responses), 2) // diagnostics for the document and the shutdown response
+	is.True(slices.Contains(responses, `{"jsonrpc":"2.0","id":2,"result":null}`))
+}
+
+func TestCancelRequest(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	h := NewTestBufferHandler(t, &buf)
+
+	started := make(chan struct{})
+	slow := func(ctx context.Context, _ lsp.ShutdownRequest) (lsp.NullResponse, error) {
+		close(started)
+		<-ctx.Done()
+		return lsp.NullResponse{}, ctx.Err()
+	}
+
+	handleAsync(h, "test/slow", []byte(`{"jsonrpc":"2.0","id":7,"method":"test/slow"}`), slow)
+	<-started
+
+	// Replacing the index waits for the slow request, and meanwhile blocks
+	// new readers of the index
+	replaced := make(chan struct{})
+	go func() {
+		h.indexMu.Lock()
+		h.indexMu.Unlock()
+		close(replaced)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	t.Run("slow requests do not block document notifications", func(t *testing.T) {
+		h.handleMessage(TEXT_DOCUMENT_DID_OPEN, []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.rb","version":1,"text":"foo.bar\n"}}}`))
+		h.handleMessage(TEXT_DOCUMENT_DID_CHANGE, []byte(`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///a.rb","version":2},"contentChanges":[{"text":"foo.baz\n"}]}}`))
+
+		text, ok := h.State.Document("file:///a.rb")
+		is.True(ok)
+		is.Equal(text, "foo.baz\n")
+	})
+
+	t.Run("it answers cancelled requests with RequestCancelled", func(t *testing.T) {
+		h.handleMessage(CANCEL_REQUEST, []byte(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":7}}`))
+		h.inflight.Wait()
+		<-replaced
+		h.background.Wait()
+
+		// The diagnostics of the latest version of the document, and the
+		// cancelled request's response
+		responses := ReadTestResponses(t, &buf)
+		is.Equal(len(responses), 2)
+		is.True(slices.Contains(responses, `{"jsonrpc":"2.0","id":7,"error":{"code":-32800,"message":"request for method 'test/slow' was cancelled"}}`))
+	})
+
+	t.Run("it ignores cancellation of finished requests", func(t *testing.T) {
+		h.handleMessage(CANCEL_REQUEST, []byte(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":7}}`))
+		is.Equal(len(ReadTestResponses(t, &buf)), 0)
+	})
+
+	t.Run("it cancels requests with string ids", func(t *testing.T) {
+		started = make(chan struct{})
+		handleAsync(h, "test/slow", []byte(`{"jsonrpc":"2.0","id":"slow","method":"test/slow"}`), slow)
+		<-started
+
+		h.handleMessage(CANCEL_REQUEST, []byte(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":"slow"}}`))
+		h.inflight.Wait()
+
+		is.Equal(ReadTestResponses(t, &buf), []string{
+			`{"jsonrpc":"2.0","id":"slow","error":{"code":-32800,"message":"request for method 'test/slow' was cancelled"}}`,
+		})
+	})
+
+	t.Run("requests that finish regardless are answered with their result", func(t *testing.T) {
+		started = make(chan struct{})
+		handleAsync(h, "test/stubborn", []byte(`{"jsonrpc":"2.0","id":10,"method":"test/stubborn"}`), func(ctx context.Context, request lsp.ShutdownRequest) (lsp.NullResponse, error) {
+			close(started)
+			<-ctx.Done()
+			return lsp.NewNullResponse(&request.ID), nil
+		})
+		<-started
+
+		h.handleMessage(CANCEL_REQUEST, []byte(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":10}}`))
+		h.inflight.Wait()
+
+		is.Equal(ReadTestResponses(t, &buf), []string{`{"jsonrpc":"2.0","id":10,"result":null}`})
+	})
+
+	t.Run("shutdown cancels in-flight requests", func(t *testing.T) {
+		started = make(chan struct{})
+		handleAsync(h, "test/slow", []byte(`{"jsonrpc":"2.0","id":8,"method":"test/slow"}`), slow)
+		<-started
+
+		h.handleMessage(SHUTDOWN, []byte(`{"jsonrpc":"2.0","id":9,"method":"shutdown"}`))
+		h.background.Wait()
+
+		is.Equal(ReadTestResponses(t, &buf), []string{
+			`{"jsonrpc":"2.0","id":8,"error":{"code":-32800,"message":"request for method 'test/slow' was cancelled"}}`,
+			`{"jsonrpc":"2.0","id":9,"result":null}`,
+		})
+	})
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	h := NewTestBufferHandler(t, &buf)
+	uri := "file:///a.rb"
+
+	h.handleMessage(TEXT_DOCUMENT_DID_OPEN, []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"`+uri+`","version":1,"text":"transaction.call\n"}}}`))
+
+	for i := 2; i < 50; i++ {
+		h.handleMessage(TEXT_DOCUMENT_HOVER, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"textDocument/hover","params":{"textDocument":{"uri":"%s"},"position":{"line":0,"character":3}}}`, i, uri)))
+		h.handleMessage(TEXT_DOCUMENT_DEFINITION, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"textDocument/definition","params":{"textDocument":{"uri":"%s"},"position":{"line":0,"character":3}}}`, 100+i, uri)))
+		h.handleMessage(TEXT_DOCUMENT_DID_CHANGE, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"%s","version":%d},"contentChanges":[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"text":"x"}]}}`, uri, i)))
+	}
+	h.inflight.Wait()
+	h.background.Wait()
+
+	// one response per request, and the diagnostics of the last version,
+	// those of earlier ones may be dropped
+	responses := ReadTestResponses(t, &buf)
+	is.True(len(responses) > 48*2)
+	is.True(slices.ContainsFunc(responses, func(r string) bool { return strings.Contains(r, `"version":49`) }))
+
+	text, _ := h.State.Document(uri)
+	is.Equal(text, strings.Repeat("x", 48)+"transaction.call\n")
+}
+
+func TestShutdownAndExit(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("it exits with 0 after shutdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		h := NewTestBufferHandler(t, &buf)
+		code := -1
+		h.exit = func(c int) { code = c }
+
+		h.handleMessage(SHUTDOWN, []byte(`{"jsonrpc":"2.0","id":1,"method":"shutdown"}`))
+		h.background.Wait()
+		h.handleMessage(TEXT_DOCUMENT_HOVER, []byte(`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{}}`))
+		h.handleMessage(TEXT_DOCUMENT_DID_OPEN, []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{}}`))
+		h.handleMessage(EXIT, []byte(`{"jsonrpc":"2.0","method":"exit"}`))
+
+		is.Equal(ReadTestResponses(t, &buf), []string{
+			`{"jsonrpc":"2.0","id":1,"result":null}`,
+			`{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"received 'textDocument/hover' after shutdown"}}`,
+		})
+		is.Equal(code, 0)
+	})
+
+	t.Run("it exits with 1 without shutdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		h := NewTestBufferHandler(t, &buf)
+		code := -1
+		h.exit = func(c int) { code = c }
+
+		h.handleMessage(EXIT, []byte(`{"jsonrpc":"2.0","method":"exit"}`))
+
+		is.Equal(code, 1)
+	})
+}
+
+func TestWatchParentProcess(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	h := NewTestBufferHandler(t, &buf)
+	exited := false
+	h.exit = func(int) { exited = true }
+
+	watching := make(chan struct{})
+	go func() {
+		h.watchParentProcess(h.serving, os.Getpid())
+		close(watching)
+	}()
+
+	h.Serve()
+
+	select {
+	case <-watching:
+	case <-time.After(time.Second):
+		t.Fatal("the watcher outlived the connection")
+	}
+	is.True(!exited)
+}
+
+func NewTestBufferHandler(t *testing.T, buf *bytes.Buffer) *Handler {
+	logger := getLogger("out.log")
+	h := NewHandler(logger, rpc.NewConn(bytes.NewReader(nil), buf), analysis.NewState(logger))
+	h.initialized = true
+
+	return h
+}
+
+func ReadTestResponses(t *testing.T, buf *bytes.Buffer) []string {
+	r := rpc.NewReader(buf)
+
+	var responses []string
+	for {
+		_, content, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid response: %s", err)
+		}
+		responses = append(responses, string(content))
+	}
+
+	return responses
+}
+
 func NewTestHandler(t *testing.T) *Handler {
 	h := NewDefaultHandler()
 
@@ -358,7 +674,7 @@ func NewTestDefinitionRequest(opts ...OptFunc) lsp.DefinitionRequest {
 	return lsp.DefinitionRequest{
 		Request: lsp.Request{
 			RPC: "2.0",
-			ID:  1,
+			ID:  lsp.IntID(1),
 		},
 		Params: lsp.DefinitionParams{
 			TextDocumentPositionParams: lsp.TextDocumentPositionParams{
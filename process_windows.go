@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// processExists reports whether a process with the given pid is running.
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	p.Release()
+	return true
+}
@@ -0,0 +1,7 @@
+; Every method called on a local identifier, e.g. `transaction.call`.
+;
+; @receiver the identifier the method is called on
+; @method   the name of the method
+(call
+  receiver: (identifier) @receiver
+  method: (identifier) @method)
@@ -0,0 +1,7 @@
+; Every class and module declaration.
+;
+; @name the declared constant, possibly a scope resolution like `Foo::Bar`
+[
+  (class name: (_) @name)
+  (module name: (_) @name)
+]
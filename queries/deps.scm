@@ -0,0 +1,10 @@
+; Every `include Deps[...]` call.
+;
+; @include  the `include` method name
+; @deps     the constant being indexed, filtered to Deps or a namespaced Deps
+; @deps_ref the element reference holding the injected keys
+(call
+  method: (identifier) @include (#eq? @include "include")
+  arguments: (argument_list
+    (element_reference
+      object: (_) @deps (#match? @deps "^(.*::)?Deps$")) @deps_ref))
@@ -0,0 +1,7 @@
+; Every instance and singleton method definition.
+;
+; @name the name of the method
+[
+  (method name: (_) @name)
+  (singleton_method name: (_) @name)
+]
@@ -0,0 +1,107 @@
+// Package queries holds the tree-sitter queries used to analyse ruby files.
+//
+// Each query is loaded from an embedded <name>.scm file and compiled once. A
+// workspace can replace any of them by putting its own <name>.scm in
+// OverrideDir, as long as it keeps the captures documented in the original.
+package queries
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/ruby"
+)
+
+// Names of the queries in the library
+const (
+	Deps        = "deps"
+	Calls       = "calls"
+	Classes     = "classes"
+	Methods     = "methods"
+	SliceConfig = "slice_config"
+	Symbols     = "symbols"
+)
+
+var names = []string{Deps, Calls, Classes, Methods, SliceConfig, Symbols}
+
+// OverrideDir is where a workspace keeps its own query files, relative to
+// the workspace root.
+const OverrideDir = ".hanamilsp/queries"
+
+//go:embed *.scm
+var embedded embed.FS
+
+// Library is a set of compiled queries, safe for concurrent use.
+type Library struct {
+	queries map[string]*sitter.Query
+}
+
+// Default holds the built-in queries.
+var Default = mustLoadEmbedded()
+
+func mustLoadEmbedded() *Library {
+	lib := &Library{queries: map[string]*sitter.Query{}}
+	for _, name := range names {
+		source, err := embedded.ReadFile(name + ".scm")
+		if err != nil {
+			panic(err)
+		}
+
+		q, err := compile(name, source)
+		if err != nil {
+			panic(err)
+		}
+		lib.queries[name] = q
+	}
+
+	return lib
+}
+
+// Load returns the built-in queries with any <name>.scm found in dir taking
+// their place. Files that fail to compile are reported in the returned error
+// and the built-in query is kept instead.
+func Load(dir string) (*Library, error) {
+	lib := &Library{queries: map[string]*sitter.Query{}}
+	for name, q := range Default.queries {
+		lib.queries[name] = q
+	}
+
+	var errs []error
+	for _, name := range names {
+		source, err := os.ReadFile(filepath.Join(dir, name+".scm"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		q, err := compile(name, source)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		lib.queries[name] = q
+	}
+
+	return lib, errors.Join(errs...)
+}
+
+// Get returns the compiled query with the given name.
+func (l *Library) Get(name string) *sitter.Query {
+	return l.queries[name]
+}
+
+func compile(name string, source []byte) (*sitter.Query, error) {
+	q, err := sitter.NewQuery(source, ruby.GetLanguage())
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile query '%s': %w", name, err)
+	}
+
+	return q, nil
+}
@@ -0,0 +1,51 @@
+package queries
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestDefault(t *testing.T) {
+	is := is.New(t)
+
+	for _, name := range names {
+		is.True(Default.Get(name) != nil) // every built-in query compiles
+	}
+}
+
+func TestLoad(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	override := `(call method: (identifier) @include arguments: (argument_list (element_reference object: (_) @deps) @deps_ref))`
+	is.NoErr(os.WriteFile(filepath.Join(dir, "deps.scm"), []byte(override), 0o644))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "calls.scm"), []byte(`(call receiver: (nope) @receiver)`), 0o644))
+
+	lib, err := Load(dir)
+
+	t.Run("it reports queries that do not compile", func(t *testing.T) {
+		is.True(err != nil)
+		is.True(lib != nil)
+	})
+
+	t.Run("it uses the override", func(t *testing.T) {
+		is.True(lib.Get(Deps) != Default.Get(Deps))
+	})
+
+	t.Run("it keeps the built-in query when an override does not compile", func(t *testing.T) {
+		is.Equal(lib.Get(Calls), Default.Get(Calls))
+	})
+
+	t.Run("it keeps the built-in query without an override", func(t *testing.T) {
+		is.Equal(lib.Get(Methods), Default.Get(Methods))
+	})
+
+	t.Run("it does not need the directory to exist", func(t *testing.T) {
+		lib, err := Load(filepath.Join(dir, "missing"))
+		is.NoErr(err)
+		is.Equal(lib.Get(Deps), Default.Get(Deps))
+	})
+}
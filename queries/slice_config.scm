@@ -0,0 +1,7 @@
+; Every `import` and `export` declaration in a slice class.
+;
+; @method the `import` or `export` method name
+; @args   the argument list of the declaration
+(call
+  method: (identifier) @method (#match? @method "^(import|export)$")
+  arguments: (argument_list) @args)
@@ -0,0 +1,24 @@
+; Declarations shown in the document outline, nested by their ranges.
+;
+; @module, @class, @method the declaration, with @name its name
+; @step                     a dry-operation `step` call, with @name its
+;                           first argument
+; @params                   an action's `params do ... end` block
+; @expose                   a view's `expose` call, with @name each exposed
+;                           symbol
+(module name: (_) @name) @module
+(class name: (_) @name) @class
+(method name: (_) @name) @method
+(singleton_method name: (_) @name) @method
+
+(call
+  method: (identifier) @_step (#eq? @_step "step")
+  arguments: (argument_list . (_) @name)) @step
+
+(call
+  method: (identifier) @_params (#eq? @_params "params")
+  block: (_)) @params
+
+(call
+  method: (identifier) @_expose (#eq? @_expose "expose")
+  arguments: (argument_list (simple_symbol) @name)) @expose
@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Error is the error object of a response, returned by Call when the client
+// answered with an error.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+type request struct {
+	RPC    string `json:"jsonrpc"`
+	ID     int    `json:"id"`
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+type response struct {
+	ID     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+type cancelNotification struct {
+	RPC    string `json:"jsonrpc"`
+	Method string `json:"method"`
+	Params struct {
+		ID int `json:"id"`
+	} `json:"params"`
+}
+
+// Call sends a request to the client and waits for its response, which is
+// unmarshalled into result unless result is nil. It gives up when ctx is
+// done, telling the client with `$/cancelRequest`, so callers bound how long
+// it waits with the ctx they pass.
+func (c *Conn) Call(ctx context.Context, method string, params any, result any) error {
+	id, ch, err := c.register()
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer c.unregister(id)
+
+	if err := c.Write(request{RPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return fmt.Errorf("%s: %w", method, ErrClosed)
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %w", method, resp.Error)
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("%s: invalid result: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		cancel := cancelNotification{RPC: "2.0", Method: "$/cancelRequest"}
+		cancel.Params.ID = id
+		c.Write(cancel)
+
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+func (c *Conn) register() (int, chan response, error) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if c.closed {
+		return 0, nil, ErrClosed
+	}
+
+	c.nextID++
+	ch := make(chan response, 1)
+	c.pending[c.nextID] = ch
+
+	return c.nextID, ch, nil
+}
+
+func (c *Conn) unregister(id int) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	delete(c.pending, id)
+}
+
+// deliver hands content to the Call waiting for it, and reports whether
+// content was a response at all. Late responses, e.g. after a timeout, are
+// dropped.
+func (c *Conn) deliver(content []byte) bool {
+	var resp response
+	if err := json.Unmarshal(content, &resp); err != nil || resp.ID == nil {
+		return false
+	}
+
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if ch, ok := c.pending[*resp.ID]; ok {
+		ch <- resp
+		delete(c.pending, *resp.ID)
+	}
+
+	return true
+}
+
+// closePending fails every Call still waiting for a response.
+func (c *Conn) closePending() {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	c.closed = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
@@ -0,0 +1,184 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hanamilsp/rpc"
+	"io"
+	"testing"
+	"time"
+)
+
+// testClient plays the editor's side of a Conn.
+type testClient struct {
+	t      *testing.T
+	conn   *rpc.Conn
+	reader *rpc.Reader
+	w      *io.PipeWriter
+	// Methods of the messages the server read with Conn.Read
+	received chan string
+}
+
+func newTestClient(t *testing.T) *testClient {
+	toServerR, toServerW := io.Pipe()
+	toClientR, toClientW := io.Pipe()
+
+	c := &testClient{
+		t:        t,
+		conn:     rpc.NewConn(toServerR, toClientW),
+		reader:   rpc.NewReader(toClientR),
+		w:        toServerW,
+		received: make(chan string, 10),
+	}
+
+	go func() {
+		for {
+			method, _, err := c.conn.Read()
+			if err != nil {
+				close(c.received)
+				return
+			}
+			c.received <- method
+		}
+	}()
+
+	t.Cleanup(func() {
+		toServerW.Close()
+		toClientR.Close()
+	})
+
+	return c
+}
+
+// request reads the next request sent by the server and returns its id.
+func (c *testClient) request(method string) int {
+	got, content, err := c.reader.Read()
+	if err != nil {
+		c.t.Fatalf("no request: %s", err)
+	}
+	if got != method {
+		c.t.Fatalf("Expected: '%s', Got: '%s'", method, got)
+	}
+
+	var msg struct {
+		ID int `json:"id"`
+	}
+	json.Unmarshal(content, &msg)
+
+	return msg.ID
+}
+
+func (c *testClient) send(content string) {
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(content), content)
+}
+
+func TestConnCall(t *testing.T) {
+	t.Run("it returns the result of the response with the same id", func(t *testing.T) {
+		c := newTestClient(t)
+
+		type call struct {
+			result string
+			err    error
+		}
+		calls := make(chan call, 2)
+		for range 2 {
+			go func() {
+				var result string
+				err := c.conn.Call(context.Background(), "workspace/configuration", nil, &result)
+				calls <- call{result, err}
+			}()
+		}
+
+		first := c.request("workspace/configuration")
+		second := c.request("workspace/configuration")
+
+		// Answer out of order, with a client request in between
+		c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"%d"}`, second, second))
+		c.send(`{"jsonrpc":"2.0","id":1,"method":"textDocument/hover"}`)
+		c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"%d"}`, first, first))
+
+		for range 2 {
+			got := <-calls
+			if got.err != nil {
+				t.Fatal(got.err)
+			}
+			if got.result != fmt.Sprint(first) && got.result != fmt.Sprint(second) {
+				t.Fatalf("Expected the result of request %d or %d, Got: %s", first, second, got.result)
+			}
+		}
+
+		if method := <-c.received; method != "textDocument/hover" {
+			t.Fatalf("Expected the client request to be read, Got: '%s'", method)
+		}
+	})
+
+	t.Run("it returns the error of the response", func(t *testing.T) {
+		c := newTestClient(t)
+
+		errs := make(chan error)
+		go func() {
+			errs <- c.conn.Call(context.Background(), "workspace/applyEdit", map[string]any{}, nil)
+		}()
+
+		id := c.request("workspace/applyEdit")
+		c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32603,"message":"nope"}}`, id))
+
+		var rpcErr *rpc.Error
+		if err := <-errs; !errors.As(err, &rpcErr) || rpcErr.Code != -32603 || rpcErr.Message != "nope" {
+			t.Fatalf("Expected the response error, Got: %v", err)
+		}
+	})
+
+	t.Run("it gives up and cancels the request when ctx is done", func(t *testing.T) {
+		c := newTestClient(t)
+
+		errs := make(chan error)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			errs <- c.conn.Call(ctx, "window/showMessageRequest", nil, nil)
+		}()
+
+		id := c.request("window/showMessageRequest")
+
+		_, content, err := c.reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := fmt.Sprintf(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":%d}}`, id); string(content) != expected {
+			t.Fatalf("Expected: %s, Got: %s", expected, content)
+		}
+
+		if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected: deadline exceeded, Got: %v", err)
+		}
+
+		// A late response is dropped rather than read as a client message
+		c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":null}`, id))
+		c.send(`{"jsonrpc":"2.0","method":"initialized"}`)
+		if method := <-c.received; method != "initialized" {
+			t.Fatalf("Expected: 'initialized', Got: '%s'", method)
+		}
+	})
+
+	t.Run("it fails pending calls when the connection closes", func(t *testing.T) {
+		c := newTestClient(t)
+
+		errs := make(chan error)
+		go func() {
+			errs <- c.conn.Call(context.Background(), "client/registerCapability", nil, nil)
+		}()
+
+		c.request("client/registerCapability")
+		c.w.Close()
+
+		if err := <-errs; !errors.Is(err, rpc.ErrClosed) {
+			t.Fatalf("Expected: %v, Got: %v", rpc.ErrClosed, err)
+		}
+		if err := c.conn.Call(context.Background(), "client/registerCapability", nil, nil); !errors.Is(err, rpc.ErrClosed) {
+			t.Fatalf("Expected: %v, Got: %v", rpc.ErrClosed, err)
+		}
+	})
+}
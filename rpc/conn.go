@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrClosed is returned by Call when the connection closes before the client
+// responded.
+var ErrClosed = errors.New("connection closed")
+
+// Conn pairs a Reader with a writer that is safe for concurrent use, and
+// correlates the responses it reads with the requests sent with Call.
+type Conn struct {
+	*Reader
+
+	mu sync.Mutex
+	w  io.Writer
+
+	pendingMu sync.Mutex
+	// Map of request ids to the channel their response is delivered on
+	pending map[int]chan response
+	nextID  int
+	closed  bool
+}
+
+// NewConn returns a Conn reading messages from r, skipping any larger than
+// DefaultMaxMessageSize, and writing them to w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{
+		Reader:  NewReaderSize(r, DefaultMaxMessageSize),
+		w:       w,
+		pending: map[int]chan response{},
+	}
+}
+
+// Read returns the next request or notification from the client. Responses
+// to requests sent with Call are delivered to their caller instead of being
+// returned.
+func (c *Conn) Read() (string, []byte, error) {
+	for {
+		method, content, err := c.Reader.Read()
+		if err != nil && !errors.Is(err, ErrInvalidMessage) {
+			c.closePending()
+			return "", nil, err
+		}
+
+		if err == nil && method == "" && c.deliver(content) {
+			continue
+		}
+
+		return method, content, err
+	}
+}
+
+// Write encodes msg and writes it as a single message.
+func (c *Conn) Write(msg any) error {
+	reply := EncodeMessage(msg)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := io.WriteString(c.w, reply)
+	return err
+}
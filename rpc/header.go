@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Header holds the header fields of a base protocol message.
+type Header struct {
+	ContentLength int
+	// Content-Type as sent by the client, empty if it was omitted
+	ContentType string
+}
+
+var ErrMissingContentLength = errors.New("missing Content-Length header")
+
+// ParseHeader parses the header part of a message, up to but excluding the
+// blank line that separates it from the content. Field names are matched
+// case-insensitively and in any order, and unknown fields are ignored.
+func ParseHeader(header []byte) (Header, error) {
+	var h Header
+	contentLength := -1
+
+	for _, line := range bytes.Split(header, []byte("\r\n")) {
+		name, value, found := bytes.Cut(line, []byte(":"))
+		if !found {
+			return Header{}, fmt.Errorf("invalid header line '%s'", line)
+		}
+
+		switch strings.ToLower(string(bytes.TrimSpace(name))) {
+		case "content-length":
+			n, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+			if err != nil || n < 0 {
+				return Header{}, fmt.Errorf("invalid Content-Length '%s'", bytes.TrimSpace(value))
+			}
+			contentLength = n
+		case "content-type":
+			h.ContentType = string(bytes.TrimSpace(value))
+		}
+	}
+
+	if contentLength < 0 {
+		return Header{}, ErrMissingContentLength
+	}
+	h.ContentLength = contentLength
+
+	return h, nil
+}
@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxHeaderSize bounds how much of a single header line is kept, anything
+// before that is garbage.
+const maxHeaderSize = 4096
+
+// initialContentSize is the most allocated for a message's content before any
+// of it is read.
+const initialContentSize = 64 * 1024
+
+// DefaultMaxMessageSize is the largest message a Conn reads, well above any
+// document an editor sends.
+const DefaultMaxMessageSize = 64 * 1024 * 1024
+
+// ErrInvalidMessage is returned by Read for a message that is framed
+// correctly but whose content cannot be decoded. Reading can continue after
+// it, unlike after any other error.
+var ErrInvalidMessage = errors.New("invalid message")
+
+// Reader reads base protocol messages one at a time, reading the header and
+// then exactly Content-Length bytes of content, so messages of any size are
+// read without buffering more than they need. Anything in between that is not
+// a well formed header is skipped.
+type Reader struct {
+	r *bufio.Reader
+	// Messages with a larger Content-Length are skipped, 0 accepts any size
+	maxMessageSize int
+}
+
+// NewReader returns a Reader that accepts messages of any size.
+func NewReader(r io.Reader) *Reader {
+	return NewReaderSize(r, 0)
+}
+
+// NewReaderSize returns a Reader that skips messages larger than
+// maxMessageSize, without reading them into memory.
+func NewReaderSize(r io.Reader, maxMessageSize int) *Reader {
+	return &Reader{
+		r:              bufio.NewReader(r),
+		maxMessageSize: maxMessageSize,
+	}
+}
+
+// Read returns the method and content of the next message, and io.EOF once
+// the underlying reader is exhausted.
+func (r *Reader) Read() (string, []byte, error) {
+	for {
+		h, err := r.readHeader()
+		if err != nil {
+			return "", nil, err
+		}
+
+		if r.maxMessageSize > 0 && h.ContentLength > r.maxMessageSize {
+			if _, err := io.CopyN(io.Discard, r.r, int64(h.ContentLength)); err != nil {
+				return "", nil, eof(err)
+			}
+			continue
+		}
+
+		// Grow the content as it arrives rather than trusting Content-Length
+		// up front, so a bogus length cannot allocate more than was sent
+		var content bytes.Buffer
+		content.Grow(min(h.ContentLength, initialContentSize))
+		if _, err := io.CopyN(&content, r.r, int64(h.ContentLength)); err != nil {
+			return "", nil, eof(err)
+		}
+
+		method, err := decodeMethod(content.Bytes())
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+		}
+
+		return method, content.Bytes(), nil
+	}
+}
+
+// readHeader reads lines up to the blank line ending a valid header. Lines
+// that cannot be part of a header discard what was read so far, and a line
+// with garbage in front of a Content-Length field starts over at that field.
+func (r *Reader) readHeader() (Header, error) {
+	var header [][]byte
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return Header{}, err
+		}
+
+		if len(line) == 0 {
+			if len(header) == 0 {
+				continue
+			}
+
+			h, err := ParseHeader(bytes.Join(header, []byte("\r\n")))
+			if err == nil {
+				return h, nil
+			}
+
+			header = nil
+			continue
+		}
+
+		if i := bytes.Index(bytes.ToLower(line), []byte("content-length")); i > 0 {
+			line = line[i:]
+			header = nil
+		}
+
+		if !bytes.Contains(line, []byte(":")) {
+			header = nil
+			continue
+		}
+
+		header = append(header, line)
+	}
+}
+
+// readLine returns the next line without its line ending. Only the last
+// maxHeaderSize bytes of longer lines are kept.
+func (r *Reader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxHeaderSize {
+			line = append([]byte(nil), line[len(line)-maxHeaderSize:]...)
+		}
+
+		switch {
+		case err == nil:
+			line = bytes.TrimSuffix(line, []byte("\n"))
+			return bytes.TrimSuffix(line, []byte("\r")), nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		default:
+			return nil, err
+		}
+	}
+}
+
+// eof reports a message cut short by the end of the input as io.EOF.
+func eof(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+
+	return err
+}
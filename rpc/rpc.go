@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
 )
 
 func EncodeMessage(msg any) string {
@@ -22,44 +21,36 @@ type BaseMessage struct {
 }
 
 func DecodeMessage(msg []byte) (string, []byte, error) {
-	header, content, found := bytes.Cut(msg, []byte{'\r', '\n', '\r', '\n'})
+	header, content, found := bytes.Cut(msg, headerSeparator)
 	if !found {
 		return "", nil, errors.New("Did not find separator")
 	}
 
-	// Content-Length: <number>
-	contentLengthBytes := header[len("Content-Length: "):]
-	contentLength, err := strconv.Atoi(string(contentLengthBytes))
+	h, err := ParseHeader(header)
 	if err != nil {
 		return "", nil, err
 	}
 
-	var baseMessage BaseMessage
-	if err := json.Unmarshal(content[:contentLength], &baseMessage); err != nil {
+	if len(content) < h.ContentLength {
+		return "", nil, fmt.Errorf("expected %d bytes of content, got %d", h.ContentLength, len(content))
+	}
+
+	method, err := decodeMethod(content[:h.ContentLength])
+	if err != nil {
 		return "", nil, err
 	}
 
-	return baseMessage.Method, content[:contentLength], nil
+	return method, content[:h.ContentLength], nil
 }
 
-// type SplitFunc func(data []byte, atEOF bool) (advance int, token []byte, err error)
-func Split(data []byte, _ bool) (advance int, token []byte, err error) {
-	header, content, found := bytes.Cut(data, []byte{'\r', '\n', '\r', '\n'})
-	if !found {
-		return 0, nil, nil
-	}
-
-	// Content-Length: <number>
-	contentLengthBytes := header[len("Content-Length: "):]
-	contentLength, err := strconv.Atoi(string(contentLengthBytes))
-	if err != nil {
-		return 0, nil, err
-	}
+var headerSeparator = []byte("\r\n\r\n")
 
-	if len(content) < contentLength {
-		return 0, nil, nil
+// decodeMethod returns the method of a message's content.
+func decodeMethod(content []byte) (string, error) {
+	var baseMessage BaseMessage
+	if err := json.Unmarshal(content, &baseMessage); err != nil {
+		return "", err
 	}
 
-	totalLength := len(header) + 4 + contentLength
-	return totalLength, data[:totalLength], nil
+	return baseMessage.Method, nil
 }
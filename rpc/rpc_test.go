@@ -1,7 +1,14 @@
 package rpc_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"hanamilsp/rpc"
+	"io"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -33,3 +40,248 @@ func TestDecode(t *testing.T) {
 		t.Fatalf("Expected: 'hi', Got: %s", method)
 	}
 }
+
+func TestParseHeader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		expected rpc.Header
+		err      bool
+	}{
+		{
+			name:     "content length only",
+			header:   "Content-Length: 15",
+			expected: rpc.Header{ContentLength: 15},
+		},
+		{
+			name:     "content type first",
+			header:   "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\nContent-Length: 15",
+			expected: rpc.Header{ContentLength: 15, ContentType: "application/vscode-jsonrpc; charset=utf-8"},
+		},
+		{
+			name:     "lowercase names and extra spaces",
+			header:   "content-length:15  \r\ncontent-type:  application/json",
+			expected: rpc.Header{ContentLength: 15, ContentType: "application/json"},
+		},
+		{
+			name:     "unknown fields are ignored",
+			header:   "X-Trace: abc\r\nContent-Length: 0",
+			expected: rpc.Header{ContentLength: 0},
+		},
+		{
+			name:   "missing content length",
+			header: "Content-Type: application/json",
+			err:    true,
+		},
+		{
+			name:   "invalid content length",
+			header: "Content-Length: -1",
+			err:    true,
+		},
+		{
+			name:   "not a header",
+			header: "{\"jsonrpc\":\"2.0\"}",
+			err:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := rpc.ParseHeader([]byte(tc.header))
+			if tc.err {
+				if err == nil {
+					t.Fatalf("Expected an error, Got: %+v", h)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h != tc.expected {
+				t.Fatalf("Expected: %+v, Got: %+v", tc.expected, h)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	message := func(method string) string {
+		content := fmt.Sprintf(`{"method":"%s"}`, method)
+		return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(content), content)
+	}
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "messages back to back",
+			input:    message("a") + message("b"),
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "content type and lowercase headers",
+			input:    "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\ncontent-length: 14\r\n\r\n{\"method\":\"a\"}" + message("b"),
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "garbage between messages",
+			input:    "garbage\r\n" + message("a") + "more garbage" + message("b"),
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "invalid header",
+			input:    "Content-Length: nope\r\n\r\n{}" + message("a"),
+			expected: []string{"a"},
+		},
+		{
+			name:     "garbage without any header",
+			input:    strings.Repeat("x", 10000) + message("a"),
+			expected: []string{"a"},
+		},
+		{
+			name:     "oversized message",
+			input:    "Content-Length: 200\r\n\r\n{\"method\":\"big\"," + strings.Repeat(" ", 183) + "}" + message("a"),
+			expected: []string{"a"},
+		},
+		{
+			name:     "truncated message",
+			input:    message("a") + "Content-Length: 100\r\n\r\n{",
+			expected: []string{"a"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := rpc.NewReaderSize(strings.NewReader(tc.input), 100)
+
+			var methods []string
+			for {
+				method, _, err := r.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				methods = append(methods, method)
+			}
+
+			if !slices.Equal(methods, tc.expected) {
+				t.Fatalf("Expected: %v, Got: %v", tc.expected, methods)
+			}
+		})
+	}
+
+	t.Run("it does not trust a bogus Content-Length", func(t *testing.T) {
+		r := rpc.NewReader(strings.NewReader("Content-Length: 9000000000000000000\r\n\r\n{}"))
+
+		if _, _, err := r.Read(); !errors.Is(err, io.EOF) {
+			t.Fatalf("Expected: EOF, Got: %v", err)
+		}
+	})
+
+	t.Run("connections skip messages over the default limit", func(t *testing.T) {
+		oversized := io.MultiReader(
+			strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n", rpc.DefaultMaxMessageSize+1)),
+			io.LimitReader(zeros{}, rpc.DefaultMaxMessageSize+1),
+			strings.NewReader(message("a")),
+		)
+		conn := rpc.NewConn(oversized, io.Discard)
+
+		method, _, err := conn.Read()
+		if err != nil || method != "a" {
+			t.Fatalf("Expected: 'a', Got: '%s', %v", method, err)
+		}
+	})
+
+	t.Run("it keeps reading after undecodable content", func(t *testing.T) {
+		r := rpc.NewReader(strings.NewReader("Content-Length: 3\r\n\r\nnop" + message("a")))
+
+		_, _, err := r.Read()
+		if !errors.Is(err, rpc.ErrInvalidMessage) {
+			t.Fatalf("Expected: %s, Got: %v", rpc.ErrInvalidMessage, err)
+		}
+
+		method, _, err := r.Read()
+		if err != nil || method != "a" {
+			t.Fatalf("Expected: 'a', Got: '%s', %v", method, err)
+		}
+	})
+}
+
+// zeros is an endless reader of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestConnWrite(t *testing.T) {
+	var buf bytes.Buffer
+	conn := rpc.NewConn(strings.NewReader(""), &buf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.Write(rpc.BaseMessage{Method: strings.Repeat("m", 1000)})
+		}()
+	}
+	wg.Wait()
+
+	r := rpc.NewReader(&buf)
+	for i := 0; i < 50; i++ {
+		method, _, err := r.Read()
+		if err != nil {
+			t.Fatalf("message %d: %s", i, err)
+		}
+		if len(method) != 1000 {
+			t.Fatalf("message %d was interleaved with another", i)
+		}
+	}
+}
+
+func TestReaderLargeMessages(t *testing.T) {
+	for _, size := range []int{64 * 1024, 1 << 20, 8 << 20} {
+		t.Run(fmt.Sprintf("%d bytes", size), func(t *testing.T) {
+			text := strings.Repeat("a", size)
+			content := fmt.Sprintf(`{"method":"textDocument/didOpen","params":{"text":"%s"}}`, text)
+
+			pr, pw := io.Pipe()
+			go func() {
+				// Deliver the message in small writes, as a pipe from the editor would
+				msg := []byte(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(content), content) + rpc.EncodeMessage(rpc.BaseMessage{Method: "next"}))
+				for len(msg) > 0 {
+					n := min(len(msg), 4096)
+					pw.Write(msg[:n])
+					msg = msg[n:]
+				}
+				pw.Close()
+			}()
+
+			r := rpc.NewReader(pr)
+
+			method, received, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if method != "textDocument/didOpen" || string(received) != content {
+				t.Fatalf("Expected the full %d bytes of content, Got: %d", len(content), len(received))
+			}
+
+			method, _, err = r.Read()
+			if err != nil || method != "next" {
+				t.Fatalf("Expected: 'next', Got: '%s', %v", method, err)
+			}
+
+			if _, _, err := r.Read(); !errors.Is(err, io.EOF) {
+				t.Fatalf("Expected: EOF, Got: %v", err)
+			}
+		})
+	}
+}
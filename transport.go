@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hanamilsp/analysis"
+	"hanamilsp/rpc"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// parseListenAddress splits a `--listen` value into the network and address
+// to pass to net.Listen.
+func parseListenAddress(listen string) (string, string, error) {
+	u, err := url.Parse(listen)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid listen address '%s': %w", listen, err)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid listen address '%s': missing host and port", listen)
+		}
+		return "tcp", u.Host, nil
+	case "unix":
+		path := u.Host + u.Path
+		if path == "" {
+			return "", "", fmt.Errorf("invalid listen address '%s': missing socket path", listen)
+		}
+		return "unix", path, nil
+	}
+
+	return "", "", fmt.Errorf("invalid listen address '%s': scheme must be tcp or unix", listen)
+}
+
+// listenAndServe accepts editor connections on listen until the process is
+// interrupted.
+func listenAndServe(logger *log.Logger, listen string) error {
+	network, address, err := parseListenAddress(listen)
+	if err != nil {
+		return err
+	}
+
+	if network == "unix" {
+		removeStaleSocket(address)
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	logger.Printf("listening on %s", listen)
+	return serveListener(logger, ln, analysis.NewWorkspaces())
+}
+
+// serveListener gives each accepted connection its own Handler and State,
+// sharing indexed workspaces between them. It returns once ln is closed and
+// every connection has finished.
+func serveListener(logger *log.Logger, ln net.Listener, workspaces *analysis.Workspaces) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveConn(logger, conn, workspaces)
+		}()
+	}
+}
+
+func serveConn(logger *log.Logger, conn net.Conn, workspaces *analysis.Workspaces) {
+	defer conn.Close()
+	logger.Printf("accepted connection from %s", conn.RemoteAddr())
+
+	state := analysis.NewState(logger)
+	state.Workspaces = workspaces
+
+	handler := NewHandler(logger, rpc.NewConn(conn, conn), state)
+	// `exit` only ends this editor's connection, the server keeps running
+	handler.exit = func(int) {
+		conn.Close()
+	}
+	handler.sharedLogger = true
+	handler.Serve()
+
+	logger.Printf("connection from %s closed", conn.RemoteAddr())
+}
+
+// removeStaleSocket deletes a unix socket left behind by a previous server
+// that did not shut down cleanly, so that listening on it again succeeds.
+func removeStaleSocket(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		// Another server is still listening, let net.Listen report it
+		conn.Close()
+		return
+	}
+
+	os.Remove(path)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hanamilsp/analysis"
+	"hanamilsp/rpc"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	is := is.New(t)
+
+	testCases := []struct {
+		listen  string
+		network string
+		address string
+		err     bool
+	}{
+		{listen: "tcp://127.0.0.1:7658", network: "tcp", address: "127.0.0.1:7658"},
+		{listen: "unix:///tmp/hanamilsp.sock", network: "unix", address: "/tmp/hanamilsp.sock"},
+		{listen: "unix://hanamilsp.sock", network: "unix", address: "hanamilsp.sock"},
+		{listen: "tcp://", err: true},
+		{listen: "udp://127.0.0.1:7658", err: true},
+		{listen: "127.0.0.1:7658", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.listen, func(t *testing.T) {
+			network, address, err := parseListenAddress(tc.listen)
+			if tc.err {
+				is.True(err != nil)
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(network, tc.network)
+			is.Equal(address, tc.address)
+		})
+	}
+}
+
+func TestServeListener(t *testing.T) {
+	is := is.New(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+
+	logger := getLogger(filepath.Join(t.TempDir(), "out.log"))
+	done := make(chan error)
+	go func() {
+		done <- serveListener(logger, ln, analysis.NewWorkspaces())
+	}()
+
+	rootURI := "file://" + t.TempDir()
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootUri":"` + rootURI + `","initializationOptions":{"log":{"level":"off"}}}}`
+
+	first := dialTestConn(t, ln.Addr().String())
+	second := dialTestConn(t, ln.Addr().String())
+
+	t.Run("each connection is initialized on its own", func(t *testing.T) {
+		for _, c := range []*testConn{first, second} {
+			c.send(initialize)
+			is.True(bytes.Contains(c.receive(), []byte(`"id":1,"result":{"capabilities"`)))
+		}
+	})
+
+	t.Run("connections do not change the shared log settings", func(t *testing.T) {
+		out := logger.Writer().(*logOutput)
+		out.mu.Lock()
+		defer out.mu.Unlock()
+
+		is.Equal(out.level, 0)
+	})
+
+	t.Run("exit only closes that connection", func(t *testing.T) {
+		first.send(`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`)
+		is.Equal(string(first.receive()), `{"jsonrpc":"2.0","id":2,"result":null}`)
+		first.send(`{"jsonrpc":"2.0","method":"exit"}`)
+		is.True(first.closed())
+
+		second.send(`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`)
+		is.Equal(string(second.receive()), `{"jsonrpc":"2.0","id":2,"result":null}`)
+	})
+
+	t.Run("it stops once the listener is closed", func(t *testing.T) {
+		second.conn.Close()
+		ln.Close()
+
+		select {
+		case err := <-done:
+			is.NoErr(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("serveListener did not return")
+		}
+	})
+}
+
+type testConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *rpc.Reader
+}
+
+func dialTestConn(t *testing.T, address string) *testConn {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	return &testConn{t: t, conn: conn, reader: rpc.NewReader(conn)}
+}
+
+func (c *testConn) send(content string) {
+	if _, err := fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		c.t.Fatalf("could not send: %s", err)
+	}
+}
+
+func (c *testConn) receive() []byte {
+	_, content, err := c.reader.Read()
+	if err != nil {
+		c.t.Fatalf("no response: %s", err)
+	}
+
+	return content
+}
+
+// closed reports whether the server closed the connection.
+func (c *testConn) closed() bool {
+	_, _, err := c.reader.Read()
+	return errors.Is(err, io.EOF)
+}